@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+var (
+	cmdAttach = &command{
+		desc: "Attach the terminal to a process of a running procker",
+		help: `Usage: procker attach [options] process name
+
+Attach the terminal to a process of the procker start running the given
+Procfile: lines typed are sent to the process's stdin, and only its output
+is shown, so debuggers such as pry, pdb or byebug can be used. Press Ctrl-D
+(or Ctrl-C) to detach, leaving the process running.
+
+Only processes declaring attach in procker.yml, or all processes when
+'procker start' is given -attach, can be attached to: the stdin of other
+processes is the null device, so programs reading their input until its
+end don't wait for it.
+
+A single client may be attached to a process at a time, and a client
+which doesn't keep up with the process's output is disconnected.
+
+Available options:`,
+		exec: attach,
+		flag: attachFlags}
+
+	// flags
+	attachFlags    = flag.NewFlagSet("attach", flag.ExitOnError)
+	attachProcfile = procfileFlag(attachFlags)
+)
+
+func attach(args []string) {
+	if len(args) != 1 {
+		fail("you must specify a process. See 'procker help attach'.\n")
+	}
+
+	conn, err := dialControl(controlSocket(*attachProcfile))
+	if err != nil {
+		fail("procker is not running (%s)\n", errorMessage(err))
+	}
+	defer conn.Close()
+
+	failIf(json.NewEncoder(conn).Encode(controlRequest{"attach", args}))
+
+	// the response is followed by the process's output
+	r := bufio.NewReader(conn)
+	line, err := r.ReadBytes('\n')
+	failIf(err)
+	var response controlResponse
+	failIf(json.Unmarshal(line, &response))
+	if response.Error != "" {
+		fail("%s\n", response.Error)
+	}
+
+	fmt.Fprintf(os.Stderr, "attached to %s, press Ctrl-D to detach\n", args[0])
+	go func() {
+		io.Copy(conn, os.Stdin)
+		conn.(*net.UnixConn).CloseWrite()
+	}()
+	io.Copy(os.Stdout, r)
+}
+
+// serveAttach attaches conn to the named member, until input ends.
+func serveAttach(conn net.Conn, input io.Reader, mg *manager, names []string) {
+	m, err := mg.findOne(names)
+	var detach func()
+	if err == nil {
+		detach, err = m.attach(conn)
+	}
+
+	var response controlResponse
+	if err != nil {
+		response.Error = err.Error()
+		json.NewEncoder(conn).Encode(response)
+		return
+	}
+	defer detach()
+
+	response.Processes = []processStatus{m.status()}
+	if err := json.NewEncoder(conn).Encode(response); err != nil {
+		return
+	}
+
+	log.Printf("%s attached", m.name)
+	io.Copy(memberInput{m}, input)
+	log.Printf("%s detached", m.name)
+}
+
+// findOne returns the member named by names, which must name
+// a single member.
+func (mg *manager) findOne(names []string) (*member, error) {
+	found, err := mg.find(names)
+	if err != nil {
+		return nil, err
+	}
+	if len(found) > 1 {
+		list := make([]string, len(found))
+		for i, m := range found {
+			list[i] = m.name
+		}
+		return nil, fmt.Errorf("several processes match, choose one of %s", strings.Join(list, ", "))
+	}
+	return found[0], nil
+}
+
+// attach copies the member's output to w, until detached.
+func (m *member) attach(w io.Writer) (detach func(), err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.attachable {
+		return nil, fmt.Errorf("%s doesn't accept input, see 'procker help attach'", m.name)
+	}
+	if m.attached {
+		return nil, fmt.Errorf("%s is already attached", m.name)
+	}
+	m.attached = true
+
+	detachOutput := m.output.attach(w)
+	return func() {
+		detachOutput()
+		m.mu.Lock()
+		m.attached = false
+		m.mu.Unlock()
+	}, nil
+}
+
+// memberInput writes to the stdin of the member's current process.
+// Input is discarded while the process is not running.
+type memberInput struct {
+	m *member
+}
+
+func (in memberInput) Write(p []byte) (int, error) {
+	in.m.mu.Lock()
+	stdin := in.m.stdin
+	in.m.mu.Unlock()
+
+	if stdin != nil {
+		stdin.Write(p)
+	}
+	return len(p), nil
+}
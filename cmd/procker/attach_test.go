@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestServeAttach(t *testing.T) {
+	m := stubMember("web", "cat")
+	m.attachable = true
+	m.process.Stdout = m.output
+	mg := newManager([]*member{m, stubMember("worker", "sleep 10")}, time.Second)
+	if err := mg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		mg.Stop(time.Second)
+		mg.Wait()
+	}()
+
+	client, server := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		serveAttach(server, server, mg, []string{"web"})
+		server.Close()
+		close(done)
+	}()
+
+	r := bufio.NewReader(client)
+	var response controlResponse
+	line, err := r.ReadBytes('\n')
+	assert(t, nil, err)
+	assert(t, nil, json.Unmarshal(line, &response))
+	assert(t, "", response.Error)
+	assert(t, "web", response.Processes[0].Name)
+
+	// a single client at a time
+	_, err = m.attach(&strings.Builder{})
+	assert(t, "web is already attached", errorMessage(err))
+
+	client.Write([]byte("hello\n"))
+	line, err = r.ReadBytes('\n')
+	assert(t, nil, err)
+	assert(t, "hello\n", string(line))
+
+	client.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("attach must end with its input")
+	}
+	detach, err := m.attach(&strings.Builder{})
+	assert(t, nil, err)
+	detach()
+}
+
+func TestServeAttachRequiresASingleProcess(t *testing.T) {
+	mg := newManager([]*member{stubMember("web.1", "sleep 10"), stubMember("web.2", "sleep 10")}, time.Second)
+
+	client, server := net.Pipe()
+	go serveAttach(server, server, mg, []string{"web"})
+
+	var response controlResponse
+	assert(t, nil, json.NewDecoder(client).Decode(&response))
+	assert(t, "several processes match, choose one of web.1, web.2", response.Error)
+	client.Close()
+}
+
+func TestMemberWithoutAttachReadsNullDevice(t *testing.T) {
+	m := stubMember("web", "cat")
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() { done <- m.Wait() }()
+	select {
+	case err := <-done:
+		assert(t, nil, err)
+	case <-time.After(5 * time.Second):
+		m.Stop(time.Second)
+		t.Fatal("cat must reach the end of its input")
+	}
+
+	_, err := m.attach(&strings.Builder{})
+	assert(t, "web doesn't accept input, see 'procker help attach'", errorMessage(err))
+}
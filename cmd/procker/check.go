@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/jweslley/procker"
+)
+
+var (
+	cmdCheck = &command{
+		desc: "Validate Procfile and env files",
+		help: `Usage: procker check [options]
+
+Check parses the Procfile and env files, then reports every problem found:
+syntax errors, duplicate process names, executables which can't be found
+in PATH, variables referenced by commands but never defined and processes
+sharing the same port. It exits with a non-zero status if any problem is
+found.
+
+Available options:`,
+		exec: check,
+		flag: checkFlags}
+
+	// flags
+	checkFlags    = flag.NewFlagSet("check", flag.ExitOnError)
+	checkProcfile = checkFlags.String("f", "Procfile",
+		"Procfile (or procker.yml) declaring commands to run")
+	checkEnvfiles = envFlag(checkFlags)
+	checkBasePort = checkFlags.Int("p", 5000,
+		"Base port to be used by processes")
+	checkShell = shellFlags(checkFlags)
+)
+
+func check(args []string) {
+	var problems []string
+	report := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, a...))
+	}
+
+	processes, err := loadProcesses(*checkProcfile)
+	if err != nil {
+		report("%s", errorMessage(err))
+	}
+
+	env, err := loadEnv(checkEnvfiles, os.Environ())
+	if err != nil {
+		report("%s", errorMessage(err))
+		env = os.Environ()
+	}
+
+	dir := path.Dir(*checkProcfile)
+	ports := make(map[int]string)
+	checked := make(map[string]bool)
+	for _, i := range instances(processes, nil, *checkBasePort) {
+		if other, ok := ports[i.port]; ok {
+			report("%s: %s: port %d is already used by %s", *checkProcfile, i.name, i.port, other)
+		} else {
+			ports[i.port] = i.name
+		}
+
+		if checked[i.config.Name] {
+			continue
+		}
+		checked[i.config.Name] = true
+
+		processEnv, err := loadEnvFiles(dir, i.config.EnvFiles, env)
+		if err != nil {
+			report("%s", errorMessage(err))
+		}
+
+		process := &procker.SysProcess{
+			Command:   i.config.Command,
+			Dir:       processDir(dir, i.config.Dir),
+			Env:       concat(env, processEnv, i.config.Env, []string{fmt.Sprintf("PORT=%d", i.port)}),
+			Strict:    true,
+			Shell:     checkShell.shell,
+			ShellMode: checkShell.mode,
+		}
+
+		err = process.Check()
+		if _, ok := err.(*procker.UndefinedError); ok {
+			report("%s: %s: %s", *checkProcfile, i.config.Name, errorMessage(err))
+			process.Strict = false
+			err = process.Check()
+		}
+		if err != nil {
+			report("%s: %s: %s", *checkProcfile, i.config.Name, errorMessage(err))
+		} else if checkShell.uses(process.Command) {
+			// the shell was resolved: check the commands it runs as well
+			for _, name := range procker.ShellCommands(process.Command) {
+				if _, err := procker.LookPath(name, process.Dir, process.Env); err != nil {
+					report("%s: %s: %s", *checkProcfile, i.config.Name, errorMessage(err))
+				}
+			}
+		}
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem)
+	}
+	if len(problems) > 0 {
+		fail("%d problem(s) found\n", len(problems))
+	}
+	fmt.Printf("%s: %d process(es) ok\n", *checkProcfile, len(processes))
+}
+
+// errorMessage returns the message of err without the procker prefix.
+func errorMessage(err error) string {
+	return strings.TrimPrefix(err.Error(), "procker: ")
+}
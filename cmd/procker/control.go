@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+var (
+	cmdPs = &command{
+		desc: "List processes of a running procker",
+		help: `Usage: procker ps [options]
+
+List the processes of the procker start running the given Procfile
+
+Available options:`,
+		exec: ps,
+		flag: psFlags}
+
+	cmdStop = &command{
+		desc: "Stop processes of a running procker",
+		help: `Usage: procker stop [options] process name...
+
+Stop processes of the procker start running the given Procfile. A process
+name stops all of its instances, while web.2 stops a single instance.
+
+Available options:`,
+		exec: stop,
+		flag: stopFlags}
+
+	cmdRestart = &command{
+		desc: "Restart processes of a running procker",
+		help: `Usage: procker restart [options] process name...
+
+Restart processes of the procker start running the given Procfile,
+starting them if stopped.
+
+Available options:`,
+		exec: restart,
+		flag: restartFlags}
+
+	// flags
+	psFlags         = flag.NewFlagSet("ps", flag.ExitOnError)
+	psProcfile      = procfileFlag(psFlags)
+	stopFlags       = flag.NewFlagSet("stop", flag.ExitOnError)
+	stopProcfile    = procfileFlag(stopFlags)
+	restartFlags    = flag.NewFlagSet("restart", flag.ExitOnError)
+	restartProcfile = procfileFlag(restartFlags)
+)
+
+// controlRequest is sent by client commands to a running procker start,
+// through its control socket.
+type controlRequest struct {
+	Action string   `json:"action"`
+	Names  []string `json:"names,omitempty"`
+}
+
+type controlResponse struct {
+	Processes []processStatus `json:"processes,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+func procfileFlag(flags *flag.FlagSet) *string {
+	return flags.String("f", "Procfile", "Procfile (or procker.yml) of the running procker")
+}
+
+func ps(args []string) {
+	processes := control(controlSocket(*psProcfile), "ps", nil)
+	writeStatus(os.Stdout, processes)
+}
+
+// writeStatus writes the processes' status as a table.
+func writeStatus(out io.Writer, processes []processStatus) {
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATE\tPID\tPORT\tUPTIME\tRESTARTS\tEXIT\tSTATUS")
+	for _, p := range processes {
+		pid, uptime := "-", "-"
+		if p.Pid != 0 {
+			pid = fmt.Sprint(p.Pid)
+			uptime = (time.Duration(p.Uptime) * time.Second).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%d\t%s\t%s\n",
+			p.Name, p.State, pid, p.Port, uptime, p.Restarts, p.Exit, p.Status)
+	}
+	w.Flush()
+}
+
+func stop(args []string) {
+	if len(args) == 0 {
+		fail("you must specify a process. See 'procker help stop'.\n")
+	}
+	control(controlSocket(*stopProcfile), "stop", args)
+}
+
+func restart(args []string) {
+	if len(args) == 0 {
+		fail("you must specify a process. See 'procker help restart'.\n")
+	}
+	control(controlSocket(*restartProcfile), "restart", args)
+}
+
+// controlSocket returns the path of the control socket of a procker
+// running procfile, derived from the Procfile's directory, in the
+// user's control directory.
+func controlSocket(procfile string) string {
+	dir, err := filepath.Abs(filepath.Dir(procfile))
+	failIf(err)
+	socketDir, err := controlDir()
+	failIf(err)
+	sum := sha1.Sum([]byte(dir))
+	return filepath.Join(socketDir, fmt.Sprintf("procker-%x.sock", sum[:6]))
+}
+
+// dialControl connects to the control socket, unless it's owned by
+// another user.
+func dialControl(socket string) (net.Conn, error) {
+	if err := checkOwner(socket); err != nil {
+		return nil, err
+	}
+	return net.Dial("unix", socket)
+}
+
+// controlRunning reports whether a procker is listening on socket.
+func controlRunning(socket string) bool {
+	conn, err := dialControl(socket)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// control sends a request to the procker listening on socket, failing
+// on errors, and returns the processes' status.
+func control(socket, action string, names []string) []processStatus {
+	conn, err := dialControl(socket)
+	if err != nil {
+		fail("procker is not running (%s)\n", errorMessage(err))
+	}
+	defer conn.Close()
+
+	failIf(json.NewEncoder(conn).Encode(controlRequest{action, names}))
+
+	var response controlResponse
+	failIf(json.NewDecoder(conn).Decode(&response))
+	if response.Error != "" {
+		fail("%s\n", response.Error)
+	}
+	return response.Processes
+}
+
+// listenControl serves control requests for mg on socket.
+func listenControl(socket string, mg *manager) (net.Listener, error) {
+	if err := checkOwner(socket); err != nil {
+		return nil, err
+	}
+	if !controlRunning(socket) {
+		os.Remove(socket) // stale socket
+	}
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveControl(conn, mg)
+		}
+	}()
+	return listener, nil
+}
+
+func serveControl(conn net.Conn, mg *manager) {
+	defer conn.Close()
+
+	var request controlRequest
+	decoder := json.NewDecoder(conn)
+	if err := decoder.Decode(&request); err != nil {
+		return
+	}
+
+	if request.Action == "attach" {
+		// input follows the request, once its trailing newline is skipped
+		buffered, _ := ioutil.ReadAll(decoder.Buffered())
+		buffered = bytes.TrimPrefix(buffered, []byte("\n"))
+		serveAttach(conn, io.MultiReader(bytes.NewReader(buffered), conn), mg, request.Names)
+		return
+	}
+
+	// keep procker running until the response is sent
+	mg.hold()
+	defer mg.release()
+
+	var err error
+	if request.Action != "ps" {
+		err = mg.do(request.Action, request.Names)
+	}
+
+	response := controlResponse{Processes: mg.status()}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	json.NewEncoder(conn).Encode(response)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// inRuntimeDir runs f with XDG_RUNTIME_DIR set to a new directory
+// having the given permissions.
+func inRuntimeDir(t *testing.T, perm os.FileMode, f func(dir string)) {
+	dir, err := ioutil.TempDir("", "procker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.Chmod(dir, perm)
+
+	defer os.Setenv("XDG_RUNTIME_DIR", os.Getenv("XDG_RUNTIME_DIR"))
+	os.Setenv("XDG_RUNTIME_DIR", dir)
+	f(dir)
+}
+
+func TestControl(t *testing.T) {
+	inRuntimeDir(t, 0700, func(dir string) {
+		socket := controlSocket("Procfile")
+		assert(t, dir, filepath.Dir(socket))
+
+		web := stubMember("web", "cat")
+		web.attachable = true
+		web.process.Stdout = web.output
+		mg := newManager([]*member{web, stubMember("worker", "sleep 10")}, time.Second)
+		if err := mg.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer func() {
+			mg.Stop(time.Second)
+			mg.Wait()
+		}()
+
+		listener, err := listenControl(socket, mg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+		assert(t, true, controlRunning(socket))
+
+		processes := control(socket, "ps", nil)
+		assert(t, 2, len(processes))
+		assert(t, stateRunning, processes[1].State)
+
+		processes = control(socket, "stop", []string{"worker"})
+		assert(t, "worker", processes[1].Name)
+		assert(t, stateStopped, processes[1].State)
+
+		conn, err := dialControl(socket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+
+		// input may follow the request right away
+		json.NewEncoder(conn).Encode(controlRequest{"attach", []string{"web"}})
+		conn.Write([]byte("hello\n"))
+
+		r := bufio.NewReader(conn)
+		var response controlResponse
+		line, err := r.ReadBytes('\n')
+		assert(t, nil, err)
+		assert(t, nil, json.Unmarshal(line, &response))
+		assert(t, "", response.Error)
+		line, err = r.ReadBytes('\n')
+		assert(t, nil, err)
+		assert(t, "hello\n", string(line))
+	})
+}
+
+func TestControlDirMustBePrivate(t *testing.T) {
+	inRuntimeDir(t, 0755, func(dir string) {
+		if _, err := controlDir(); err == nil {
+			t.Error("must not use a directory accessible by other users")
+		}
+	})
+}
+
+func TestControlSocketOfAnotherUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner of a file requires root")
+	}
+
+	inRuntimeDir(t, 0700, func(dir string) {
+		socket := filepath.Join(dir, "procker.sock")
+		ioutil.WriteFile(socket, nil, 0600)
+		assert(t, nil, checkOwner(socket))
+
+		os.Chown(socket, 1, 1)
+		if _, err := listenControl(socket, newManager(nil, time.Second)); err == nil {
+			t.Error("must not replace the socket of another user")
+		}
+		if _, err := dialControl(socket); err == nil {
+			t.Error("must not connect to the socket of another user")
+		}
+	})
+}
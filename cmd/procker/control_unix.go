@@ -0,0 +1,47 @@
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// controlDir returns the directory holding the control sockets of the
+// user: $XDG_RUNTIME_DIR or, if unset, a procker-UID directory created
+// in the temporary directory. Either must be private to the user.
+func controlDir() (string, error) {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), fmt.Sprintf("procker-%d", os.Getuid()))
+		if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+			return "", err
+		}
+	}
+
+	info, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !info.IsDir() || info.Mode().Perm()&0077 != 0 {
+		return "", fmt.Errorf("%s must be a directory only accessible by its owner", dir)
+	}
+	return dir, checkOwner(dir)
+}
+
+// checkOwner returns an error if path exists and is owned by another user.
+func checkOwner(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) != os.Getuid() {
+		return fmt.Errorf("%s is owned by another user", path)
+	}
+	return nil
+}
@@ -0,0 +1,17 @@
+// +build windows
+
+package main
+
+import "os"
+
+// controlDir returns the directory holding the control sockets of the
+// user, the temporary directory, which is private to the user on Windows.
+func controlDir() (string, error) {
+	return os.TempDir(), nil
+}
+
+// checkOwner is a no-op on Windows, where files of the temporary
+// directory belong to the user.
+func checkOwner(path string) error {
+	return nil
+}
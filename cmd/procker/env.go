@@ -0,0 +1,298 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/jweslley/procker"
+)
+
+const (
+	defaultEnvfile = ".env"
+
+	// envOverlayVar names the variable selecting env file overlays:
+	// when set, every env file F is followed by F.$PROCKER_ENV, if present.
+	envOverlayVar = "PROCKER_ENV"
+)
+
+// envFiles is a flag.Value holding env files, given by repeating
+// the flag or as a comma-separated list.
+type envFiles struct {
+	files []string
+	set   bool
+}
+
+func envFlag(flags *flag.FlagSet) *envFiles {
+	f := &envFiles{files: []string{defaultEnvfile}}
+	flags.Var(f, "e", "File containing environment variables to be used (repeatable)")
+	return f
+}
+
+func (f *envFiles) String() string {
+	if f == nil {
+		return ""
+	}
+	return strings.Join(f.files, ",")
+}
+
+func (f *envFiles) Set(value string) error {
+	if !f.set {
+		f.files = nil
+		f.set = true
+	}
+	for _, file := range strings.Split(value, ",") {
+		if file = strings.TrimSpace(file); file != "" {
+			f.files = append(f.files, file)
+		}
+	}
+	return nil
+}
+
+// envOptions holds the flags building the environment of processes on
+// top of the env files.
+type envOptions struct {
+	vars  envAssignments
+	only  bool
+	debug bool
+}
+
+func envOptionFlags(flags *flag.FlagSet) *envOptions {
+	o := &envOptions{}
+	flags.Var(&o.vars, "E",
+		"Set an environment variable, as KEY=VALUE, overriding env files (repeatable)")
+	flags.BoolVar(&o.only, "only-env", false,
+		"Start from an empty environment instead of procker's own")
+	flags.BoolVar(&o.debug, "debug-env", false,
+		"Print the environment of processes, layer by layer")
+	return o
+}
+
+// layers returns the environment shared by all processes: procker's own
+// environment, unless -only-env is given, followed by the env files.
+func (o *envOptions) layers(files *envFiles) ([]envLayer, error) {
+	var layers []envLayer
+	if !o.only {
+		layers = append(layers, envLayer{"environment", os.Environ()})
+	}
+	fileLayers, err := loadEnvLayers(files, flattenEnv(layers))
+	if err != nil {
+		return nil, err
+	}
+	return append(layers, fileLayers...), nil
+}
+
+// overrides returns the layer of variables given by -E.
+func (o *envOptions) overrides() envLayer {
+	return envLayer{"-E", o.vars}
+}
+
+// envAssignments is a flag.Value holding KEY=VALUE assignments, given by
+// repeating the flag. Values are taken literally, commas included.
+type envAssignments []string
+
+func (a *envAssignments) String() string {
+	if a == nil {
+		return ""
+	}
+	return strings.Join(*a, " ")
+}
+
+func (a *envAssignments) Set(value string) error {
+	if strings.Index(value, "=") <= 0 {
+		return fmt.Errorf("invalid variable '%s', expected KEY=VALUE", value)
+	}
+	*a = append(*a, value)
+	return nil
+}
+
+// envLayer holds the variables set by a single source of environment.
+// Layers are applied in order, each one overriding the previous ones.
+type envLayer struct {
+	source string
+	vars   []string
+}
+
+// flattenEnv returns the variables of all layers, in order. The result
+// is never nil, so an empty environment isn't mistaken for procker's own.
+func flattenEnv(layers []envLayer) []string {
+	env := []string{}
+	for _, layer := range layers {
+		env = append(env, layer.vars...)
+	}
+	return env
+}
+
+// writeEnvLayers writes the layers making the environment of the named
+// process, from the lowest precedence to the highest. Variables overridden
+// by a later layer are marked as such; procker's own environment is only
+// summarized.
+func writeEnvLayers(w io.Writer, name string, layers []envLayer) {
+	last := make(map[string]string)
+	for _, layer := range layers {
+		for _, v := range layer.vars {
+			last[envKey(v)] = layer.source
+		}
+	}
+
+	fmt.Fprintf(w, "environment of %s, later layers overriding earlier ones:\n", name)
+	for i, layer := range layers {
+		if layer.source == "environment" {
+			fmt.Fprintf(w, "  %d. procker's environment (%d variables)\n", i+1, len(layer.vars))
+			continue
+		}
+		fmt.Fprintf(w, "  %d. %s\n", i+1, layer.source)
+		for _, v := range layer.vars {
+			if last[envKey(v)] != layer.source {
+				fmt.Fprintf(w, "       %s (overridden)\n", v)
+			} else {
+				fmt.Fprintf(w, "       %s\n", v)
+			}
+		}
+	}
+}
+
+func envKey(v string) string {
+	if i := strings.Index(v, "="); i >= 0 {
+		return v[:i]
+	}
+	return v
+}
+
+// loadEnv returns a copy of the base environment layered with the given
+// env files and their $PROCKER_ENV overlays. Variables in each layer may
+// reference values defined in any earlier layer.
+func loadEnv(files *envFiles, base []string) ([]string, error) {
+	layers, err := loadEnvLayers(files, base)
+	if err != nil {
+		return nil, err
+	}
+	return concat(base, flattenEnv(layers)), nil
+}
+
+// loadEnvLayers reads the given env files and their overlays, as layers
+// over the base environment.
+func loadEnvLayers(files *envFiles, base []string) ([]envLayer, error) {
+	var layers []envLayer
+	env := concat(base)
+	for _, filepath := range files.files {
+		// a missing default .env is skipped, but not its overlay
+		if exists(filepath) || files.set || filepath != defaultEnvfile {
+			vars, err := loadEnvFile(filepath, env)
+			if err != nil {
+				return nil, err
+			}
+			layers = append(layers, envLayer{filepath, vars})
+			env = append(env, vars...)
+		}
+
+		if overlay := envOverlay(env); overlay != "" {
+			if filepath := filepath + "." + overlay; exists(filepath) {
+				vars, err := loadEnvFile(filepath, env)
+				if err != nil {
+					return nil, err
+				}
+				layers = append(layers, envLayer{filepath, vars})
+				env = append(env, vars...)
+			}
+		}
+	}
+	return layers, nil
+}
+
+func loadEnvFile(filepath string, base []string) ([]string, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return procker.ParseEnvOverlay(file, filepath, base)
+}
+
+// readEnvFiles reads the given env files, relative to dir, as layers
+// over the base environment.
+func readEnvFiles(dir string, files []string, base []string) []string {
+	env, err := loadEnvFiles(dir, files, base)
+	failIf(err)
+	return env
+}
+
+func loadEnvFiles(dir string, files []string, base []string) ([]string, error) {
+	layers, err := loadEnvFileLayers(dir, files, base)
+	if err != nil {
+		return nil, err
+	}
+	return concat(flattenEnv(layers)), nil
+}
+
+// loadEnvFileLayers reads the given env files, relative to dir, one
+// layer per file.
+func loadEnvFileLayers(dir string, files []string, base []string) ([]envLayer, error) {
+	var layers []envLayer
+	env := concat(base)
+	for _, file := range files {
+		filepath := processDir(dir, file)
+		vars, err := loadEnvFile(filepath, env)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, envLayer{filepath, vars})
+		env = append(env, vars...)
+	}
+	return layers, nil
+}
+
+// processEnvLayers returns the layers making the environment of a
+// process: the shared layers, the process's env files and variables, then
+// the -E overrides. procker's own variables, such as PORT, come last.
+func processEnvLayers(shared []envLayer, dir string, config procker.ProcessConfig, options *envOptions) ([]envLayer, error) {
+	files, err := loadEnvFileLayers(dir, config.EnvFiles, flattenEnv(shared))
+	if err != nil {
+		return nil, err
+	}
+	return concatLayers(shared, files, []envLayer{
+		{"env of " + config.Name, config.Env},
+		options.overrides(),
+	}), nil
+}
+
+// instanceEnvLayer returns the variables set by procker for an instance.
+func instanceEnvLayer(i instance) envLayer {
+	return envLayer{"procker", []string{fmt.Sprintf("PORT=%d", i.port), "PS=" + i.name}}
+}
+
+// concatLayers returns a new slice holding the layers of all given slices.
+func concatLayers(slices ...[]envLayer) []envLayer {
+	var s []envLayer
+	for _, slice := range slices {
+		s = append(s, slice...)
+	}
+	return s
+}
+
+// envOverlay returns the value of PROCKER_ENV, as set by env files read
+// so far or, even if -only-env is given, by procker's own environment.
+func envOverlay(env []string) string {
+	if overlay := lookupEnv(env, envOverlayVar); overlay != "" {
+		return overlay
+	}
+	return os.Getenv(envOverlayVar)
+}
+
+// lookupEnv returns the last value of key in env.
+func lookupEnv(env []string, key string) string {
+	for i := len(env) - 1; i >= 0; i-- {
+		if strings.HasPrefix(env[i], key+"=") {
+			return env[i][len(key)+1:]
+		}
+	}
+	return ""
+}
+
+func exists(filepath string) bool {
+	_, err := os.Stat(filepath)
+	return err == nil
+}
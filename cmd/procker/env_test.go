@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jweslley/procker"
+)
+
+// inTempDir runs f in a new temporary directory holding the given files.
+func inTempDir(t *testing.T, files map[string]string, f func(dir string)) {
+	dir, err := ioutil.TempDir("", "procker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	f(dir)
+}
+
+func TestLoadEnvOverlays(t *testing.T) {
+	inTempDir(t, map[string]string{
+		".env":            "A=env\nB=env\n",
+		".env.test":       "B=test\nC=$A-test\n",
+		".env.local":      "A=local\n",
+		".env.local.test": "D=local-test\n",
+	}, func(dir string) {
+		files := &envFiles{}
+		files.Set(".env,.env.local")
+
+		env, err := loadEnv(files, []string{"PROCKER_ENV=test"})
+		assert(t, nil, err)
+		assert(t, []string{"PROCKER_ENV=test", "A=env", "B=env", "B=test", "C=env-test",
+			"A=local", "D=local-test"}, env)
+	})
+}
+
+func TestLoadEnvOverlayWithoutDefaultEnvfile(t *testing.T) {
+	inTempDir(t, map[string]string{
+		".env.test": "A=test\n",
+	}, func(dir string) {
+		files := &envFiles{files: []string{defaultEnvfile}}
+
+		env, err := loadEnv(files, []string{"PROCKER_ENV=test"})
+		assert(t, nil, err)
+		assert(t, []string{"PROCKER_ENV=test", "A=test"}, env)
+	})
+}
+
+func TestProcessEnvPrecedence(t *testing.T) {
+	os.Setenv("PROCKER_TEST_OS", "os")
+	os.Setenv("PROCKER_TEST_FILE", "os")
+	defer os.Unsetenv("PROCKER_TEST_OS")
+	defer os.Unsetenv("PROCKER_TEST_FILE")
+
+	inTempDir(t, map[string]string{
+		".env":     "PROCKER_TEST_FILE=file\nPROCKER_TEST_PROCESS=file\nPROCKER_TEST_CLI=file\n",
+		".env.web": "PROCKER_TEST_PROCESS=env_file\nPROCKER_TEST_ENV=env_file\n",
+	}, func(dir string) {
+		options := &envOptions{vars: envAssignments{"PROCKER_TEST_CLI=cli", "PORT=1"}}
+		config := procker.ProcessConfig{
+			Name:     "web",
+			EnvFiles: []string{".env.web"},
+			Env:      []string{"PROCKER_TEST_ENV=env", "PROCKER_TEST_CLI=env"},
+		}
+
+		env := processEnv(t, options, dir, config)
+		for key, expected := range map[string]string{
+			"PROCKER_TEST_OS":      "os",
+			"PROCKER_TEST_FILE":    "file",
+			"PROCKER_TEST_PROCESS": "env_file",
+			"PROCKER_TEST_ENV":     "env",
+			"PROCKER_TEST_CLI":     "cli",
+			"PORT":                 "5000",
+			"PS":                   "web",
+		} {
+			assert(t, expected, lookupEnv(env, key))
+		}
+	})
+}
+
+func TestProcessEnvOnlyEnv(t *testing.T) {
+	os.Setenv("PROCKER_TEST_OS", "os")
+	os.Setenv("PROCKER_ENV", "test")
+	defer os.Unsetenv("PROCKER_TEST_OS")
+	defer os.Unsetenv("PROCKER_ENV")
+
+	inTempDir(t, map[string]string{
+		".env":      "A=env\n",
+		".env.test": "B=test\n",
+	}, func(dir string) {
+		options := &envOptions{vars: envAssignments{"C=cli"}, only: true}
+
+		env := processEnv(t, options, dir, procker.ProcessConfig{Name: "web"})
+		assert(t, []string{"A=env", "B=test", "C=cli", "PORT=5000", "PS=web"}, env)
+	})
+}
+
+// processEnv returns the environment of the first instance of config.
+func processEnv(t *testing.T, options *envOptions, dir string, config procker.ProcessConfig) []string {
+	shared, err := options.layers(&envFiles{files: []string{defaultEnvfile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	layers, err := processEnvLayers(shared, dir, config, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	i := instance{name: config.Name, port: 5000, config: config}
+	return flattenEnv(concatLayers(layers, []envLayer{instanceEnvLayer(i)}))
+}
+
+func TestWriteEnvLayers(t *testing.T) {
+	var buf bytes.Buffer
+	writeEnvLayers(&buf, "web", []envLayer{
+		{"environment", []string{"HOME=/root", "A=os"}},
+		{".env", []string{"A=file", "B=file"}},
+		{"env of web", nil},
+		{"-E", []string{"B=cli"}},
+		{"procker", []string{"PORT=5000", "PS=web"}},
+	})
+
+	assert(t, `environment of web, later layers overriding earlier ones:
+  1. procker's environment (2 variables)
+  2. .env
+       A=file
+       B=file (overridden)
+  3. env of web
+  4. -E
+       B=cli
+  5. procker
+       PORT=5000
+       PS=web
+`, buf.String())
+}
@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/jweslley/procker"
+)
+
+var (
+	cmdExport = &command{
+		desc: "Export the application to another process manager",
+		help: `Usage: procker export [options] FORMAT LOCATION
+
+Export the processes specified by a Procfile as configuration files
+for another process manager, written to LOCATION.
+
+Available formats:
+
+  systemd      a target for the application, wanting a target per process,
+               which wants an instance of the process's template service
+               per port: app.target, app-web.target, app-web@.service,
+               and a drop-in setting PS per instance
+  supervisord  a program per process instance, grouped in app.conf
+  runit        a service directory per process instance: app-web-1/run
+  launchd      a property list per process instance: app.web.1.plist
+
+Processes are run through the shell, using the environment read from
+env files, their PORT and PS. As with 'procker start', variables in env
+files may reference procker's own environment. Processes without restart
+policy are always restarted.
+
+Formats are sets of Go templates (see text/template), rendered once for
+the application (app/), once per process (process/) or once per process
+instance (instance/). A template's path, minus the scope directory and
+any .tmpl extension, is a template for the path of the file written.
+Rendered files starting with #! are made executable, empty ones are not
+written. Templates are given .App, .Process and .Instance, as relevant
+for their scope, .Env, the instance's environment, and .Instances, the
+data of every instance in scope.
+
+Use -T to read templates from a directory, following the same layout:
+they replace the built-in templates of FORMAT having the same path, or
+make a new FORMAT.
+
+Available options:`,
+		exec: export,
+		flag: exportFlags}
+
+	// flags
+	exportFlags    = flag.NewFlagSet("export", flag.ExitOnError)
+	exportProcfile = exportFlags.String("f", "Procfile",
+		"Procfile (or procker.yml) declaring commands to run")
+	exportEnvfiles = envFlag(exportFlags)
+	exportBasePort = exportFlags.Int("p", 5000,
+		"Base port to be used by processes")
+	exportStopTimeout = exportFlags.Int("t", 5,
+		"Time (in seconds) for graceful stop of processes")
+	exportApp = exportFlags.String("a", "",
+		"Application name (default: Procfile's directory name)")
+	exportUser = exportFlags.String("u", "",
+		"User to run processes as")
+	exportFormation = exportFlags.String("m", "",
+		"Number of instances of each process, e.g. web=2,worker=1,all=1")
+	exportTemplates = exportFlags.String("T", "",
+		"Directory containing export templates")
+)
+
+// exportedApp holds everything known about an application being exported.
+type exportedApp struct {
+	Name      string
+	Dir       string
+	Location  string
+	User      string
+	Shell     string
+	Env       []envVar
+	Processes []*exportedProcess
+}
+
+// exportedProcess is a process of an exported application.
+type exportedProcess struct {
+	Name        string
+	Command     string
+	Dir         string
+	Env         []envVar
+	Restart     string
+	StopSignal  string
+	StopTimeout int
+	Instances   []*exportedInstance
+}
+
+// exportedInstance is a running copy of an exported process.
+type exportedInstance struct {
+	Name string
+	Num  int
+	Port int
+}
+
+type envVar struct {
+	Key   string
+	Value string
+}
+
+// exportData is given to export templates.
+type exportData struct {
+	App      *exportedApp
+	Process  *exportedProcess
+	Instance *exportedInstance
+}
+
+// Env returns the environment of the process instance being rendered.
+func (d exportData) Env() []envVar {
+	env := append([]envVar{}, d.App.Env...)
+	if d.Process != nil {
+		env = append(env, d.Process.Env...)
+	}
+	if d.Instance != nil {
+		env = append(env,
+			envVar{"PORT", strconv.Itoa(d.Instance.Port)},
+			envVar{"PS", d.Instance.Name})
+	}
+	return env
+}
+
+// Instances returns the data of every instance of the process being
+// rendered or, in the application scope, of every process.
+func (d exportData) Instances() []exportData {
+	var list []exportData
+	for _, p := range d.App.Processes {
+		if d.Process != nil && d.Process != p {
+			continue
+		}
+		for _, i := range p.Instances {
+			list = append(list, exportData{App: d.App, Process: p, Instance: i})
+		}
+	}
+	return list
+}
+
+func export(args []string) {
+	if len(args) != 2 {
+		fail("you must specify a format and a location. See 'procker help export'.\n")
+	}
+
+	format, location := args[0], args[1]
+	templates, err := loadExportTemplates(format, *exportTemplates)
+	failIf(err)
+
+	app := buildExportedApp()
+	app.Location, err = filepath.Abs(location)
+	failIf(err)
+
+	files, err := renderExport(templates, app)
+	failIf(err)
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		target := path.Join(location, name)
+		mode := os.FileMode(0644)
+		if bytes.HasPrefix(files[name], []byte("#!")) {
+			mode = 0755
+		}
+
+		fmt.Printf("writing %s\n", target)
+		failIf(os.MkdirAll(path.Dir(target), 0755))
+		failIf(ioutil.WriteFile(target, files[name], mode))
+	}
+}
+
+// loadExportTemplates returns the templates of format, by path,
+// replaced by the ones found in dir, if given.
+func loadExportTemplates(format, dir string) (map[string]string, error) {
+	templates := make(map[string]string)
+	for name, content := range exportFormats[format] {
+		templates[name] = content
+	}
+
+	if dir != "" {
+		err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			content, err := ioutil.ReadFile(file)
+			if err != nil {
+				return err
+			}
+			name, _ := filepath.Rel(dir, file)
+			templates[strings.TrimSuffix(filepath.ToSlash(name), ".tmpl")] = string(content)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(templates) == 0 {
+		return nil, fmt.Errorf("unknown export format '%s'. See 'procker help export'", format)
+	}
+	return templates, nil
+}
+
+// renderExport renders templates for app, returning the content
+// of the files to be written, by path.
+func renderExport(templates map[string]string, app *exportedApp) (map[string][]byte, error) {
+	files := make(map[string][]byte)
+	render := func(name, content string, data exportData) error {
+		pathTemplate := strings.SplitN(name, "/", 2)[1]
+		file, err := renderTemplate(name+" (path)", pathTemplate, data)
+		if err != nil {
+			return err
+		}
+		out, err := renderTemplate(name, content, data)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(out) == "" {
+			return nil
+		}
+		if _, ok := files[file]; ok {
+			return fmt.Errorf("%s: file %s rendered more than once", name, file)
+		}
+		files[file] = []byte(out)
+		return nil
+	}
+
+	for name, content := range templates {
+		var err error
+		switch scope := strings.SplitN(name, "/", 2)[0]; {
+		case !strings.Contains(name, "/"):
+			err = fmt.Errorf("%s: template outside of app/, process/ or instance/", name)
+		case scope == "app":
+			err = render(name, content, exportData{App: app})
+		case scope == "process":
+			for _, p := range app.Processes {
+				if len(p.Instances) > 0 && err == nil {
+					err = render(name, content, exportData{App: app, Process: p})
+				}
+			}
+		case scope == "instance":
+			for _, p := range app.Processes {
+				for _, i := range p.Instances {
+					if err == nil {
+						err = render(name, content, exportData{App: app, Process: p, Instance: i})
+					}
+				}
+			}
+		default:
+			err = fmt.Errorf("%s: unknown template scope '%s'", name, scope)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func renderTemplate(name, content string, data exportData) (string, error) {
+	t, err := template.New(name).Funcs(exportFuncs).Parse(content)
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+func buildExportedApp() *exportedApp {
+	procfile, err := filepath.Abs(*exportProcfile)
+	failIf(err)
+
+	processes := parseProfile(procfile)
+	formation, err := parseFormation(*exportFormation)
+	failIf(err)
+	for i := range processes {
+		if n, ok := formation[processes[i].Name]; ok {
+			processes[i].Instances = n
+		} else if n, ok := formation["all"]; ok {
+			processes[i].Instances = n
+		}
+	}
+
+	base := os.Environ()
+	env, err := loadEnv(exportEnvfiles, base)
+	failIf(err)
+
+	dir := path.Dir(procfile)
+	app := &exportedApp{
+		Name:  *exportApp,
+		Dir:   dir,
+		User:  *exportUser,
+		Shell: procker.DefaultShell,
+		Env:   envVars(env[len(base):]),
+	}
+	if app.Name == "" {
+		app.Name = path.Base(dir)
+	}
+
+	byName := make(map[string]*exportedProcess)
+	for _, i := range instances(processes, nil, *exportBasePort) {
+		p, ok := byName[i.config.Name]
+		if !ok {
+			p = newExportedProcess(app, i.config, env)
+			byName[i.config.Name] = p
+			app.Processes = append(app.Processes, p)
+		}
+		p.Instances = append(p.Instances, &exportedInstance{i.name, len(p.Instances) + 1, i.port})
+	}
+	return app
+}
+
+func newExportedProcess(app *exportedApp, config procker.ProcessConfig, env []string) *exportedProcess {
+	// run through the shell, as exec when possible, leaving leading
+	// assignments to the shell, which expands their values
+	cmd, err := procker.NewShellScriptCommand(app.Shell, config.Command)
+	failIf(err)
+
+	p := &exportedProcess{
+		Name:        config.Name,
+		Command:     cmd.Args[2],
+		Dir:         processDir(app.Dir, config.Dir),
+		Env:         envVars(concat(readEnvFiles(app.Dir, config.EnvFiles, env), config.Env)),
+		Restart:     config.Restart,
+		StopSignal:  "SIGTERM",
+		StopTimeout: *exportStopTimeout,
+	}
+	if p.Restart == "" {
+		p.Restart = procker.RestartAlways
+	}
+	if config.StopSignal != nil {
+		p.StopSignal = signalName(config.StopSignal)
+	}
+	if config.StopTimeout > 0 {
+		p.StopTimeout = int(config.StopTimeout / time.Second)
+	}
+	return p
+}
+
+func envVars(env []string) []envVar {
+	vars := make([]envVar, 0, len(env))
+	for _, pair := range env {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) == 2 {
+			vars = append(vars, envVar{kv[0], kv[1]})
+		}
+	}
+	return vars
+}
+
+// signalName returns the name of sig, such as SIGTERM.
+func signalName(sig os.Signal) string {
+	for _, name := range []string{"HUP", "INT", "QUIT", "KILL", "USR1", "USR2", "TERM", "WINCH"} {
+		if s, err := procker.ParseSignal(name); err == nil && s == sig {
+			return "SIG" + name
+		}
+	}
+	return sig.String()
+}
+
+// parseFormation parses a formation such as "web=2,worker=1,all=1".
+func parseFormation(s string) (map[string]int, error) {
+	formation := make(map[string]int)
+	if s == "" {
+		return formation, nil
+	}
+
+	for _, entry := range strings.Split(s, ",") {
+		pair := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(pair) != 2 {
+			return nil, fmt.Errorf("invalid formation entry '%s'", entry)
+		}
+		n, err := strconv.Atoi(pair[1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid formation entry '%s'", entry)
+		}
+		formation[pair[0]] = n
+	}
+	return formation, nil
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// exportFuncs are the functions available to export templates.
+var exportFuncs = template.FuncMap{
+	// shquote quotes s for the shell
+	"shquote": func(s string) string {
+		return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+	},
+	// dquote quotes s in double quotes, using backslash escapes
+	"dquote": func(s string) string {
+		r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+		return `"` + r.Replace(s) + `"`
+	},
+	// xml escapes s for XML documents
+	"xml": func(s string) string {
+		return template.HTMLEscapeString(s)
+	},
+	// signal returns the name of a signal, without the SIG prefix
+	"signal": func(s string) string {
+		return strings.TrimPrefix(s, "SIG")
+	},
+	// percent escapes '%' as '%%', as done by systemd and supervisord
+	"percent": func(s string) string {
+		return strings.Replace(s, "%", "%%", -1)
+	},
+	// systemdExec returns a ExecStart command line running command
+	// through the shell, escaping systemd's variable substitutions
+	"systemdExec": func(shell, command string) string {
+		r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "%", "%%", "$", "$$")
+		return fmt.Sprintf(`%s -c "%s"`, shell, r.Replace(command))
+	},
+	// dotenv formats env as a file of KEY="value" entries, as understood
+	// by procker, systemd and most dotenv implementations
+	"dotenv": func(env []envVar) string {
+		var buf bytes.Buffer
+		r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "$", `\$`, "\n", `\n`)
+		for _, v := range env {
+			fmt.Fprintf(&buf, "%s=\"%s\"\n", v.Key, r.Replace(v.Value))
+		}
+		return buf.String()
+	},
+}
+
+// exportFormats holds the built-in export formats, as templates by path.
+var exportFormats = map[string]map[string]string{
+	"systemd": {
+		"app/{{.App.Name}}.target": `[Unit]
+Description={{.App.Name}}
+Wants={{range $i, $p := .App.Processes}}{{if $p.Instances}}{{if $i}} {{end}}{{$.App.Name}}-{{$p.Name}}.target{{end}}{{end}}
+
+[Install]
+WantedBy=multi-user.target
+`,
+		"app/{{.App.Name}}.env": `{{dotenv .App.Env}}`,
+		"process/{{.App.Name}}-{{.Process.Name}}.target": `[Unit]
+Description={{.App.Name}} {{.Process.Name}}
+PartOf={{.App.Name}}.target
+Wants={{range $i, $n := .Process.Instances}}{{if $i}} {{end}}{{$.App.Name}}-{{$.Process.Name}}@{{$n.Port}}.service{{end}}
+`,
+		"process/{{.App.Name}}-{{.Process.Name}}@.service": `[Unit]
+Description={{.App.Name}} {{.Process.Name}} on port %i
+PartOf={{.App.Name}}-{{.Process.Name}}.target
+StopWhenUnneeded=yes
+
+[Service]
+{{with .App.User}}User={{.}}
+{{end}}WorkingDirectory={{.Process.Dir}}
+EnvironmentFile={{.App.Location}}/{{.App.Name}}.env
+Environment=PORT=%i
+{{range .Process.Env}}Environment={{percent (dquote (printf "%s=%s" .Key .Value))}}
+{{end}}ExecStart={{systemdExec .App.Shell .Process.Command}}
+Restart={{.Process.Restart}}
+KillSignal={{.Process.StopSignal}}
+KillMode=mixed
+TimeoutStopSec={{.Process.StopTimeout}}
+`,
+		"instance/{{.App.Name}}-{{.Process.Name}}@{{.Instance.Port}}.service.d/ps.conf": `[Service]
+Environment={{percent (dquote (printf "PS=%s" .Instance.Name))}}
+`,
+	},
+
+	"supervisord": {
+		"app/{{.App.Name}}.conf": `{{range .Instances}}[program:{{.App.Name}}-{{.Process.Name}}-{{.Instance.Num}}]
+command={{.App.Shell}} -c {{percent (dquote .Process.Command)}}
+directory={{.Process.Dir}}
+environment={{range $n, $v := .Env}}{{if $n}},{{end}}{{$v.Key}}={{percent (dquote $v.Value)}}{{end}}
+{{with .App.User}}user={{.}}
+{{end}}autostart=true
+autorestart={{if eq .Process.Restart "always"}}true{{else if eq .Process.Restart "on-failure"}}unexpected{{else}}false{{end}}
+exitcodes=0
+stopsignal={{signal .Process.StopSignal}}
+stopwaitsecs={{.Process.StopTimeout}}
+stopasgroup=true
+killasgroup=true
+redirect_stderr=true
+
+{{end}}[group:{{.App.Name}}]
+programs={{range $n, $d := .Instances}}{{if $n}},{{end}}{{$d.App.Name}}-{{$d.Process.Name}}-{{$d.Instance.Num}}{{end}}
+`,
+	},
+
+	"runit": {
+		"instance/{{.App.Name}}-{{.Process.Name}}-{{.Instance.Num}}/run": `#!/bin/sh
+cd {{shquote .Process.Dir}}
+{{range .Env}}export {{.Key}}={{shquote .Value}}
+{{end}}exec 2>&1
+exec {{with .App.User}}chpst -u {{.}} {{end}}{{.App.Shell}} -c {{shquote .Process.Command}}
+`,
+		"instance/{{.App.Name}}-{{.Process.Name}}-{{.Instance.Num}}/finish": `{{if ne .Process.Restart "always"}}#!/bin/sh
+{{if eq .Process.Restart "on-failure"}}[ "$1" = 0 ] && {{end}}exec sv down "$(pwd)"
+{{end}}`,
+		"instance/{{.App.Name}}-{{.Process.Name}}-{{.Instance.Num}}/control/t": `{{if ne .Process.StopSignal "SIGTERM"}}#!/bin/sh
+kill -{{signal .Process.StopSignal}} "$(cat supervise/pid)"
+{{end}}`,
+		"instance/{{.App.Name}}-{{.Process.Name}}-{{.Instance.Num}}/log/run": `#!/bin/sh
+mkdir -p ./main
+exec svlogd -tt ./main
+`,
+	},
+
+	"launchd": {
+		"instance/{{.App.Name}}.{{.Process.Name}}.{{.Instance.Num}}.plist": `<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+  <key>Label</key>
+  <string>{{xml .App.Name}}.{{xml .Process.Name}}.{{.Instance.Num}}</string>
+  <key>ProgramArguments</key>
+  <array>
+    <string>{{xml .App.Shell}}</string>
+    <string>-c</string>
+    <string>{{xml .Process.Command}}</string>
+  </array>
+  <key>WorkingDirectory</key>
+  <string>{{xml .Process.Dir}}</string>
+  <key>EnvironmentVariables</key>
+  <dict>
+{{- range .Env}}
+    <key>{{xml .Key}}</key>
+    <string>{{xml .Value}}</string>
+{{- end}}
+  </dict>
+{{- with .App.User}}
+  <key>UserName</key>
+  <string>{{xml .}}</string>
+{{- end}}
+  <key>RunAtLoad</key>
+  <true/>
+  <key>KeepAlive</key>
+{{- if eq .Process.Restart "always"}}
+  <true/>
+{{- else if eq .Process.Restart "on-failure"}}
+  <dict>
+    <key>SuccessfulExit</key>
+    <false/>
+  </dict>
+{{- else}}
+  <false/>
+{{- end}}
+  <key>ExitTimeOut</key>
+  <integer>{{.Process.StopTimeout}}</integer>
+</dict>
+</plist>
+`,
+	},
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/jweslley/procker"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files of export tests")
+
+func assert(t *testing.T, expected, actual interface{}) {
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("expected: %+v, actual: %+v", expected, actual)
+	}
+}
+
+func testExportedApp() *exportedApp {
+	app := &exportedApp{
+		Name:     "shop",
+		Dir:      "/srv/shop",
+		Location: "/etc/shop",
+		User:     "deploy",
+		Shell:    "/bin/sh",
+		Env:      []envVar{{"RAILS_ENV", "production"}, {"GREETING", `say "hi" for $5 (100%)`}},
+	}
+
+	web := newExportedProcess(app, procker.ProcessConfig{
+		Name:    "web",
+		Command: "bundle exec puma -p $PORT",
+		Env:     []string{"WORKERS=2"},
+	}, nil)
+	web.Instances = []*exportedInstance{{"web.1", 1, 5000}, {"web.2", 2, 5001}}
+
+	worker := newExportedProcess(app, procker.ProcessConfig{
+		Name:        "worker",
+		Command:     "QUEUE=mail rake jobs:work | tee -a log/worker.log",
+		Dir:         "worker",
+		Restart:     procker.RestartOnFailure,
+		StopSignal:  syscall.SIGINT,
+		StopTimeout: 30 * time.Second,
+	}, nil)
+	worker.Instances = []*exportedInstance{{"worker", 1, 5100}}
+
+	app.Processes = []*exportedProcess{web, worker}
+	return app
+}
+
+func TestExportFormats(t *testing.T) {
+	for format := range exportFormats {
+		templates, err := loadExportTemplates(format, "")
+		assert(t, nil, err)
+		files, err := renderExport(templates, testExportedApp())
+		assert(t, nil, err)
+		assertGolden(t, filepath.Join("testdata", "export", format), files)
+	}
+}
+
+// assertGolden compares files with the ones found in dir, which are
+// rewritten when the -update flag is given.
+func assertGolden(t *testing.T, dir string, files map[string][]byte) {
+	if *updateGolden {
+		os.RemoveAll(dir)
+		for name, content := range files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			os.MkdirAll(filepath.Dir(path), 0755)
+			if err := ioutil.WriteFile(path, content, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	golden := make(map[string][]byte)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		name, _ := filepath.Rel(dir, path)
+		golden[filepath.ToSlash(name)] = content
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert(t, fileNames(golden), fileNames(files))
+	for name, content := range golden {
+		if actual, ok := files[name]; ok && string(actual) != string(content) {
+			t.Errorf("%s/%s differs:\n%s", dir, name, actual)
+		}
+	}
+}
+
+func fileNames(files map[string][]byte) []string {
+	names := []string{}
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestExportTemplateOverrides(t *testing.T) {
+	service := readGolden(t, "systemd", "shop-web@.service")
+	inTempDir(t, map[string]string{
+		"templates/app/{{.App.Name}}.target.tmpl":    "[Unit]\nDescription={{.App.Name}} app\n",
+		"templates/instance/{{.Instance.Name}}.port": "{{.Instance.Port}}\n",
+	}, func(dir string) {
+		templates, err := loadExportTemplates("systemd", "templates")
+		assert(t, nil, err)
+		assert(t, len(exportFormats["systemd"])+1, len(templates))
+
+		files, err := renderExport(templates, testExportedApp())
+		assert(t, nil, err)
+		assert(t, "[Unit]\nDescription=shop app\n", string(files["shop.target"]))
+		assert(t, "5001\n", string(files["web.2.port"]))
+		assert(t, string(service), string(files["shop-web@.service"]))
+
+		// a new format
+		templates, err = loadExportTemplates("custom", "templates")
+		assert(t, nil, err)
+		assert(t, 2, len(templates))
+	})
+
+	_, err := loadExportTemplates("custom", "")
+	if err == nil {
+		t.Errorf("must not load an unknown format")
+	}
+}
+
+func readGolden(t *testing.T, format, name string) []byte {
+	content, err := ioutil.ReadFile(filepath.Join("testdata", "export", format, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestExportRejectsInvalidTemplates(t *testing.T) {
+	for _, templates := range []map[string]string{
+		{"shop.conf": "outside of a scope"},
+		{"node/{{.App.Name}}": "unknown scope"},
+		{"app/{{.App.Name}}": "{{.Unknown}}"},
+		{"instance/{{.App.Name}}.conf": "rendered once per instance"},
+	} {
+		if _, err := renderExport(templates, testExportedApp()); err == nil {
+			t.Errorf("must not render %v", templates)
+		}
+	}
+}
+
+func TestExportedProcessLeavesAssignmentsToTheShell(t *testing.T) {
+	p := newExportedProcess(testExportedApp(), procker.ProcessConfig{
+		Name:    "web",
+		Command: "PATH=$PATH:bin RACK_ENV=production puma -p $PORT",
+	}, nil)
+
+	assert(t, "PATH=$PATH:bin RACK_ENV=production exec puma -p $PORT", p.Command)
+	assert(t, []envVar{}, p.Env)
+}
+
+func TestParseFormation(t *testing.T) {
+	for s, expected := range map[string]map[string]int{
+		"":                   {},
+		"web=2":              {"web": 2},
+		"web=2, worker=0":    {"web": 2, "worker": 0},
+		"all=1,clock=3":      {"all": 1, "clock": 3},
+		"web=2,web=3":        {"web": 3},
+		"web":                nil,
+		"web=two":            nil,
+		"web=-1":             nil,
+		"web=1,,worker=2":    nil,
+		"web=2,worker=1=two": nil,
+	} {
+		formation, err := parseFormation(s)
+		if expected == nil {
+			if err == nil {
+				t.Errorf("must not parse %q", s)
+			}
+			continue
+		}
+		assert(t, nil, err)
+		assert(t, expected, formation)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jweslley/procker"
+)
+
+// serveHTTP serves the HTTP API for mg on addr, returning the address
+// listened on. Addresses without host are bound to localhost.
+func serveHTTP(addr, token string, mg *manager) (string, error) {
+	if !strings.Contains(addr, ":") {
+		addr = ":" + addr
+	}
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", err
+	}
+
+	host, _, _ := net.SplitHostPort(addr)
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	go http.Serve(listener, &httpAPI{mg: mg, token: token, host: host, port: port})
+	return listener.Addr().String(), nil
+}
+
+// httpAPI exposes a manager through HTTP:
+//
+//	GET  /processes
+//	GET  /processes/NAME
+//	GET  /processes/NAME/output?n=N
+//	POST /processes/NAME/{start,stop,restart}
+//	POST /processes/NAME/signal?signal=SIG
+//	GET  /metrics
+//
+// Requests must be addressed to the host and port listened on, or an IP
+// address, defeating DNS rebinding, and POST requests must carry the
+// X-Procker header, which cross-origin simple requests can't set.
+type httpAPI struct {
+	mg    *manager
+	token string
+	host  string
+	port  string
+}
+
+// controlHeader must be set by POST requests.
+const controlHeader = "X-Procker"
+
+type httpError struct {
+	Error string `json:"error"`
+}
+
+func (api *httpAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !api.allowedHost(r.Host) {
+		writeJSON(w, http.StatusForbidden, httpError{"invalid host"})
+		return
+	}
+	if r.Method == "POST" && r.Header.Get(controlHeader) == "" {
+		writeJSON(w, http.StatusForbidden, httpError{"missing " + controlHeader + " header"})
+		return
+	}
+	if !api.authorized(r) {
+		writeJSON(w, http.StatusUnauthorized, httpError{"invalid token"})
+		return
+	}
+
+	if r.URL.Path == "/metrics" {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, api.mg)
+		return
+	}
+
+	path := strings.Trim(r.URL.Path, "/")
+	parts := strings.Split(path, "/")
+	if parts[0] != "processes" || len(parts) > 3 {
+		writeJSON(w, http.StatusNotFound, httpError{"not found"})
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		if r.Method != "GET" {
+			writeJSON(w, http.StatusMethodNotAllowed, httpError{"method not allowed"})
+			return
+		}
+		writeJSON(w, http.StatusOK, api.mg.status())
+	case len(parts) == 2:
+		if r.Method != "GET" {
+			writeJSON(w, http.StatusMethodNotAllowed, httpError{"method not allowed"})
+			return
+		}
+		api.show(w, parts[1])
+	case parts[2] == "output":
+		if r.Method != "GET" {
+			writeJSON(w, http.StatusMethodNotAllowed, httpError{"method not allowed"})
+			return
+		}
+		api.output(w, r, parts[1])
+	default:
+		if r.Method != "POST" {
+			writeJSON(w, http.StatusMethodNotAllowed, httpError{"method not allowed"})
+			return
+		}
+		api.action(w, r, parts[1], parts[2])
+	}
+}
+
+// allowedHost reports whether host, as given by the Host header, names
+// the address listened on: its port, on the configured host, localhost
+// or an IP address.
+func (api *httpAPI) allowedHost(host string) bool {
+	name, port, err := net.SplitHostPort(host)
+	if err != nil || port != api.port {
+		return false
+	}
+	return strings.EqualFold(name, api.host) || strings.EqualFold(name, "localhost") ||
+		net.ParseIP(name) != nil
+}
+
+func (api *httpAPI) authorized(r *http.Request) bool {
+	if api.token == "" {
+		return true
+	}
+
+	token := r.URL.Query().Get("token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(api.token)) == 1
+}
+
+func (api *httpAPI) show(w http.ResponseWriter, name string) {
+	members, err := api.mg.find([]string{name})
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, httpError{err.Error()})
+		return
+	}
+
+	list := make([]processStatus, len(members))
+	for i, m := range members {
+		list[i] = m.status()
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func (api *httpAPI) output(w http.ResponseWriter, r *http.Request, name string) {
+	members, err := api.mg.find([]string{name})
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, httpError{err.Error()})
+		return
+	}
+
+	n := 100
+	if s := r.URL.Query().Get("n"); s != "" {
+		if n, err = strconv.Atoi(s); err != nil {
+			writeJSON(w, http.StatusBadRequest, httpError{fmt.Sprintf("invalid n '%s'", s)})
+			return
+		}
+	}
+
+	output := make(map[string][]string)
+	for _, m := range members {
+		output[m.name] = m.output.last(n)
+	}
+	writeJSON(w, http.StatusOK, output)
+}
+
+func (api *httpAPI) action(w http.ResponseWriter, r *http.Request, name, action string) {
+	if _, err := api.mg.find([]string{name}); err != nil {
+		writeJSON(w, http.StatusNotFound, httpError{err.Error()})
+		return
+	}
+
+	names := []string{name}
+	api.mg.hold()
+	defer api.mg.release()
+
+	var err error
+	switch action {
+	case "start", "stop", "restart":
+		err = api.mg.do(action, names)
+	case "signal":
+		sig, e := procker.ParseSignal(r.URL.Query().Get("signal"))
+		if e != nil {
+			writeJSON(w, http.StatusBadRequest, httpError{e.Error()})
+			return
+		}
+		log.Printf("sending %s to %s", signalName(sig), name)
+		err = api.mg.signal(names, sig)
+	default:
+		writeJSON(w, http.StatusNotFound, httpError{"not found"})
+		return
+	}
+
+	if err != nil {
+		writeJSON(w, http.StatusConflict, httpError{err.Error()})
+		return
+	}
+	api.show(w, name)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
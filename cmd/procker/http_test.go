@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestHTTPRejectsForeignRequests(t *testing.T) {
+	api := &httpAPI{mg: newManager(nil, 0), host: "localhost", port: "5999"}
+
+	for _, c := range []struct {
+		method, host string
+		header       bool
+		code         int
+	}{
+		{"GET", "localhost:5999", false, http.StatusOK},
+		{"GET", "127.0.0.1:5999", false, http.StatusOK},
+		{"GET", "[::1]:5999", false, http.StatusOK},
+		{"GET", "evil.example.com:5999", false, http.StatusForbidden},
+		{"GET", "localhost:80", false, http.StatusForbidden},
+		{"GET", "localhost", false, http.StatusForbidden},
+		{"POST", "localhost:5999", false, http.StatusForbidden},
+		{"POST", "evil.example.com:5999", true, http.StatusForbidden},
+		{"POST", "localhost:5999", true, http.StatusNotFound},
+	} {
+		path := "/processes"
+		if c.method == "POST" {
+			path = "/processes/web/stop"
+		}
+		r := httptest.NewRequest(c.method, path, nil)
+		r.Host = c.host
+		if c.header {
+			r.Header.Set(controlHeader, "1")
+		}
+
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, r)
+		if w.Code != c.code {
+			t.Errorf("%s %s (header: %v): expected %d, actual %d", c.method, c.host, c.header, c.code, w.Code)
+		}
+	}
+}
@@ -24,6 +24,12 @@ func init() {
 	commands = map[string]*command{
 		"start":   cmdStart,
 		"run":     cmdRun,
+		"check":   cmdCheck,
+		"export":  cmdExport,
+		"ps":      cmdPs,
+		"stop":    cmdStop,
+		"restart": cmdRestart,
+		"attach":  cmdAttach,
 		"version": cmdVersion,
 		"help":    cmdHelp,
 	}
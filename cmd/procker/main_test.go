@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// TestMain runs procker itself, instead of the tests, when
+// PROCKER_TEST_MAIN is set: see prockerCommand.
+func TestMain(m *testing.M) {
+	if os.Getenv("PROCKER_TEST_MAIN") != "" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// prockerCommand returns a command running procker with the given
+// arguments, as a separate process.
+func prockerCommand(args ...string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), "PROCKER_TEST_MAIN=1")
+	return cmd
+}
+
+// lineReader returns a function reading the next line from r, failing
+// the test if none is read before timeout.
+func lineReader(t *testing.T, r io.Reader, timeout time.Duration) func() string {
+	lines := make(chan string)
+	go func() {
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+		close(lines)
+	}()
+
+	return func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(timeout):
+			t.Fatal("no line read")
+			return ""
+		}
+	}
+}
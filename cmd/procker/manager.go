@@ -0,0 +1,337 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// manager controls the members started by procker start. Members may be
+// stopped, started and restarted individually while procker runs, which
+// lasts until no member is running.
+//
+// procker exits with the exit code of the first member which failed,
+// that is exited with a non-zero code without being stopped.
+type manager struct {
+	members []*member
+	timeout time.Duration
+
+	mu       sync.Mutex
+	active   int
+	done     chan struct{}
+	finished bool
+	failed   *member
+	exitCode int
+}
+
+func newManager(members []*member, timeout time.Duration) *manager {
+	return &manager{members: members, timeout: timeout, done: make(chan struct{})}
+}
+
+func (mg *manager) Start() error {
+	mg.hold()
+	defer mg.release()
+
+	for _, m := range mg.list() {
+		if err := mg.startMember(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (mg *manager) Stop(timeout time.Duration) error {
+	mg.each(mg.list(), func(m *member) error {
+		if m.Running() {
+			m.Stop(timeout)
+		}
+		return nil
+	})
+	return nil
+}
+
+func (mg *manager) Signal(sig os.Signal) error {
+	return mg.each(mg.list(), func(m *member) error {
+		if m.Running() {
+			return m.Signal(sig)
+		}
+		return nil
+	})
+}
+
+func (mg *manager) Wait() error {
+	<-mg.done
+	return nil
+}
+
+func (mg *manager) Running() bool {
+	mg.mu.Lock()
+	defer mg.mu.Unlock()
+	return !mg.finished
+}
+
+// do performs a start, stop or restart action on the named members.
+func (mg *manager) do(action string, names []string) error {
+	switch action {
+	case "start":
+		log.Printf("starting %s", strings.Join(names, ", "))
+		return mg.start(names)
+	case "stop":
+		log.Printf("stopping %s", strings.Join(names, ", "))
+		return mg.stop(names)
+	case "restart":
+		log.Printf("restarting %s", strings.Join(names, ", "))
+		return mg.restart(names)
+	}
+	return fmt.Errorf("unknown action '%s'", action)
+}
+
+// start starts the named members which are not running.
+func (mg *manager) start(names []string) error {
+	members, err := mg.find(names)
+	if err != nil {
+		return err
+	}
+
+	mg.hold()
+	defer mg.release()
+	return mg.each(members, func(m *member) error {
+		if m.Running() {
+			return nil
+		}
+		return mg.startMember(m)
+	})
+}
+
+// stop stops the named members which are running.
+func (mg *manager) stop(names []string) error {
+	members, err := mg.find(names)
+	if err != nil {
+		return err
+	}
+
+	return mg.each(members, func(m *member) error {
+		if m.Running() {
+			m.Stop(mg.timeout)
+		}
+		return nil
+	})
+}
+
+// restart stops the named members, if running, and starts them again.
+func (mg *manager) restart(names []string) error {
+	members, err := mg.find(names)
+	if err != nil {
+		return err
+	}
+
+	mg.hold()
+	defer mg.release()
+	return mg.each(members, func(m *member) error {
+		if m.Running() {
+			m.Stop(mg.timeout)
+		}
+		if err := mg.startMember(m); err != nil {
+			return err
+		}
+		m.mu.Lock()
+		m.restarts++
+		m.mu.Unlock()
+		return nil
+	})
+}
+
+// signal sends sig to the named members which are running.
+func (mg *manager) signal(names []string, sig os.Signal) error {
+	members, err := mg.find(names)
+	if err != nil {
+		return err
+	}
+
+	return mg.each(members, func(m *member) error {
+		if m.Running() {
+			return m.Signal(sig)
+		}
+		return nil
+	})
+}
+
+// names returns the names of the members which are running.
+func (mg *manager) names() []string {
+	var names []string
+	for _, m := range mg.list() {
+		if m.Running() {
+			names = append(names, m.name)
+		}
+	}
+	return names
+}
+
+// list returns the current members.
+func (mg *manager) list() []*member {
+	mg.mu.Lock()
+	defer mg.mu.Unlock()
+	return mg.members
+}
+
+// reload replaces the members by the given ones: new members are started,
+// removed ones are stopped, and changed ones are restarted, while running
+// members which didn't change are left alone.
+func (mg *manager) reload(members []*member) error {
+	mg.hold()
+	defer mg.release()
+
+	current := make(map[string]*member)
+	for _, m := range mg.list() {
+		current[m.name] = m
+	}
+
+	var next, started, stopped []*member
+	for _, m := range members {
+		old, ok := current[m.name]
+		delete(current, m.name)
+		switch {
+		case !ok:
+			log.Printf("adding %s", m.name)
+			started = append(started, m)
+		case old.sameAs(m):
+			m = old
+		default:
+			log.Printf("%s changed, restarting", m.name)
+			stopped = append(stopped, old)
+			started = append(started, m)
+		}
+		next = append(next, m)
+	}
+	for _, m := range current {
+		log.Printf("removing %s", m.name)
+		stopped = append(stopped, m)
+	}
+
+	mg.each(stopped, func(m *member) error {
+		if m.Running() {
+			m.Stop(mg.timeout)
+		}
+		m.close()
+		return nil
+	})
+
+	mg.mu.Lock()
+	mg.members = next
+	mg.mu.Unlock()
+
+	return mg.each(started, mg.startMember)
+}
+
+// status reports the state of every member.
+func (mg *manager) status() []processStatus {
+	members := mg.list()
+	list := make([]processStatus, len(members))
+	for i, m := range members {
+		list[i] = m.status()
+	}
+	return list
+}
+
+func (mg *manager) startMember(m *member) error {
+	mg.hold()
+	if err := m.Start(); err != nil {
+		mg.release()
+		return fmt.Errorf("%s: %s", m.name, errorMessage(err))
+	}
+
+	go func() {
+		err := m.Wait()
+		mg.exited(m, err)
+		mg.release()
+	}()
+	return nil
+}
+
+// exited records the exit code of the first member which failed.
+func (mg *manager) exited(m *member, err error) {
+	if err == nil || m.status().State != stateExited {
+		return
+	}
+
+	mg.mu.Lock()
+	defer mg.mu.Unlock()
+	if mg.failed == nil {
+		mg.failed = m
+		mg.exitCode = exitCode(err)
+	}
+}
+
+// exitStatus returns the exit code procker must exit with, logging
+// the member it comes from.
+func (mg *manager) exitStatus() int {
+	mg.mu.Lock()
+	defer mg.mu.Unlock()
+
+	if mg.failed != nil {
+		log.Printf("%s failed, exiting with code %d", mg.failed.name, mg.exitCode)
+	}
+	return mg.exitCode
+}
+
+// find returns the members named by names; a process name
+// matches all of its instances.
+func (mg *manager) find(names []string) ([]*member, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no process given")
+	}
+
+	var found []*member
+	members := mg.list()
+	for _, name := range names {
+		n := len(found)
+		for _, m := range members {
+			if m.name == name || strings.HasPrefix(m.name, name+".") {
+				found = append(found, m)
+			}
+		}
+		if len(found) == n {
+			return nil, fmt.Errorf("unknown process '%s'", name)
+		}
+	}
+	return found, nil
+}
+
+// each calls f on every given member concurrently, returning
+// the first error found.
+func (mg *manager) each(members []*member, f func(m *member) error) error {
+	errs := make(chan error, len(members))
+	for _, m := range members {
+		go func(m *member) {
+			errs <- f(m)
+		}(m)
+	}
+
+	var err error
+	for range members {
+		if e := <-errs; e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+// hold keeps procker running while members are being acted upon.
+func (mg *manager) hold() {
+	mg.mu.Lock()
+	defer mg.mu.Unlock()
+	mg.active++
+}
+
+func (mg *manager) release() {
+	mg.mu.Lock()
+	defer mg.mu.Unlock()
+	mg.active--
+	if mg.active == 0 && !mg.finished {
+		mg.finished = true
+		close(mg.done)
+	}
+}
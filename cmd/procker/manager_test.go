@@ -0,0 +1,172 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/jweslley/procker"
+)
+
+// stubMember creates a member running command, with no output.
+func stubMember(name, command string) *member {
+	return &member{
+		name: name,
+		port: 5000,
+		process: &procker.SysProcess{
+			Command: command,
+			Env:     []string{"PS=" + name},
+			Stdout:  ioutil.Discard,
+			Stderr:  ioutil.Discard,
+		},
+		output: newOutputBuffer(10),
+	}
+}
+
+func TestMemberSameAs(t *testing.T) {
+	schedule, _ := procker.ParseSchedule("@daily")
+
+	for _, c := range []struct {
+		name   string
+		change func(m *member)
+		same   bool
+	}{
+		{"unchanged", func(m *member) {}, true},
+		{"output", func(m *member) { m.output = newOutputBuffer(5) }, true},
+		{"port", func(m *member) { m.port = 5100 }, false},
+		{"restart", func(m *member) { m.restart = procker.RestartAlways }, false},
+		{"stop timeout", func(m *member) { m.stopTimeout = time.Second }, false},
+		{"schedule", func(m *member) { m.schedule = schedule }, false},
+		{"notify", func(m *member) { m.notify = true }, false},
+		{"attach", func(m *member) { m.attachable = true }, false},
+		{"watchdog", func(m *member) { m.watchdog = time.Second }, false},
+		{"command", func(m *member) { m.process.Command = "sleep 20" }, false},
+		{"dir", func(m *member) { m.process.Dir = "web" }, false},
+		{"env", func(m *member) { m.process.Env = append(m.process.Env, "DEBUG=1") }, false},
+		{"stop signal", func(m *member) { m.process.StopSignal = os.Interrupt }, false},
+		{"shell", func(m *member) { m.process.ShellMode = procker.ShellAlways }, false},
+		{"socket", func(m *member) { m.process.ListenFiles = []*os.File{os.Stdin} }, false},
+	} {
+		m, other := stubMember("web", "sleep 10"), stubMember("web", "sleep 10")
+		c.change(other)
+		if m.sameAs(other) != c.same {
+			t.Errorf("%s: expected sameAs to be %v", c.name, c.same)
+		}
+	}
+}
+
+func TestManagerReload(t *testing.T) {
+	log.SetOutput(ioutil.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, c := range []struct {
+		name      string
+		current   map[string]string
+		next      map[string]string
+		kept      []string
+		restarted []string
+		removed   []string
+	}{
+		{
+			name:    "unchanged",
+			current: map[string]string{"web": "sleep 10", "worker": "sleep 10"},
+			next:    map[string]string{"web": "sleep 10", "worker": "sleep 10"},
+			kept:    []string{"web", "worker"},
+		},
+		{
+			name:    "added",
+			current: map[string]string{"web": "sleep 10"},
+			next:    map[string]string{"web": "sleep 10", "worker": "sleep 10"},
+			kept:    []string{"web"},
+		},
+		{
+			name:    "removed",
+			current: map[string]string{"web": "sleep 10", "worker": "sleep 10"},
+			next:    map[string]string{"web": "sleep 10"},
+			kept:    []string{"web"},
+			removed: []string{"worker"},
+		},
+		{
+			name:      "changed",
+			current:   map[string]string{"web": "sleep 10", "worker": "sleep 10"},
+			next:      map[string]string{"web": "sleep 10", "worker": "sleep 20"},
+			kept:      []string{"web"},
+			restarted: []string{"worker"},
+		},
+		{
+			name:      "all at once",
+			current:   map[string]string{"web": "sleep 10", "worker": "sleep 10", "clock": "sleep 10"},
+			next:      map[string]string{"web": "sleep 10", "worker": "sleep 20", "mailer": "sleep 10"},
+			kept:      []string{"web"},
+			restarted: []string{"worker"},
+			removed:   []string{"clock"},
+		},
+	} {
+		var current, next []*member
+		old := make(map[string]*member)
+		for _, name := range sortedKeys(c.current) {
+			m := stubMember(name, c.current[name])
+			current = append(current, m)
+			old[name] = m
+		}
+		for _, name := range sortedKeys(c.next) {
+			next = append(next, stubMember(name, c.next[name]))
+		}
+
+		mg := newManager(current, time.Second)
+		if err := mg.Start(); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if err := mg.reload(next); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+		}
+
+		members := make(map[string]*member)
+		for _, m := range mg.list() {
+			members[m.name] = m
+			if !m.Running() {
+				t.Errorf("%s: %s must be running", c.name, m.name)
+			}
+		}
+		assert(t, sortedKeys(c.next), sortedNames(mg.list()))
+
+		for _, name := range c.kept {
+			if members[name] != old[name] {
+				t.Errorf("%s: %s must be kept running", c.name, name)
+			}
+		}
+		for _, name := range append(c.restarted, c.removed...) {
+			if old[name].Running() {
+				t.Errorf("%s: %s must be stopped", c.name, name)
+			}
+		}
+		for _, name := range c.restarted {
+			if members[name] == old[name] {
+				t.Errorf("%s: %s must be replaced", c.name, name)
+			}
+		}
+
+		mg.Stop(time.Second)
+		mg.Wait()
+	}
+}
+
+func sortedNames(members []*member) []string {
+	names := make(map[string]string)
+	for _, m := range members {
+		names[m.name] = ""
+	}
+	return sortedKeys(names)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/exec"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jweslley/procker"
+)
+
+// restartDelay is the time to wait before restarting an exited process.
+const restartDelay = 1 * time.Second
+
+// Member states, as reported by status.
+const (
+	stateRunning    = "running"
+	stateRestarting = "restarting"
+	stateStopped    = "stopped"
+	stateExited     = "exited"
+	stateScheduled  = "scheduled"
+)
+
+// member is a process started by procker, restarted according to
+// its restart policy until stopped. Members having a schedule are
+// run at the scheduled times instead.
+type member struct {
+	name        string
+	port        int
+	restart     string
+	stopTimeout time.Duration
+	schedule    *procker.Schedule
+	overlap     string
+	notify      bool
+	watchdog    time.Duration
+	process     *procker.SysProcess
+	output      *outputBuffer
+
+	mu        sync.Mutex
+	running   bool
+	stopping  bool
+	exited    chan struct{}
+	err       error
+	state     string
+	startedAt time.Time
+	restarts  int
+	exits     map[int]int
+	cancel    chan time.Duration
+	next      time.Time
+
+	attachable bool
+	stdin      *os.File
+	attached   bool
+
+	notifier      *procker.NotifySocket
+	keepAlive     chan struct{}
+	ready         bool
+	statusText    string
+	watchdogFired bool
+}
+
+// processStatus describes the state of a member.
+type processStatus struct {
+	Name     string    `json:"name"`
+	State    string    `json:"state"`
+	Pid      int       `json:"pid,omitempty"`
+	Port     int       `json:"port"`
+	Started  time.Time `json:"started"`
+	Uptime   float64   `json:"uptime"`
+	Restarts int       `json:"restarts"`
+	Next     time.Time `json:"next,omitempty"`
+	Exit     string    `json:"exit,omitempty"`
+	ExitCode int       `json:"exit_code"`
+	Ready    bool      `json:"ready"`
+	Status   string    `json:"status,omitempty"`
+}
+
+func (m *member) Start() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.running {
+		return errors.New("procker: already started")
+	}
+
+	if m.notify || m.watchdog > 0 {
+		if err := m.listenNotify(); err != nil {
+			return err
+		}
+	}
+	m.ready = false
+	m.statusText = ""
+
+	if m.schedule != nil {
+		m.startSchedule()
+		return nil
+	}
+
+	if err := m.startProcess(); err != nil {
+		return err
+	}
+
+	m.running = true
+	m.stopping = false
+	m.state = stateRunning
+	m.startedAt = time.Now()
+	m.exited = make(chan struct{})
+	go m.supervise(m.exited)
+	if m.watchdog > 0 {
+		go m.runWatchdog(m.exited)
+	}
+	return nil
+}
+
+// startProcess starts the process. Its stdin is a pipe kept to be
+// attached to if the member is attachable, the null device otherwise.
+// Must be called with m.mu held.
+func (m *member) startProcess() error {
+	if !m.attachable {
+		return m.process.Start()
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+
+	m.process.Stdin = r
+	err = m.process.Start()
+	r.Close()
+	if err != nil {
+		w.Close()
+		return err
+	}
+
+	if m.stdin != nil {
+		m.stdin.Close()
+	}
+	m.stdin = w
+	return nil
+}
+
+func (m *member) supervise(exited chan struct{}) {
+	for {
+		err := m.process.Wait()
+
+		m.mu.Lock()
+		if m.exits == nil {
+			m.exits = make(map[int]int)
+		}
+		m.exits[exitCode(err)]++
+		restart := !m.stopping && (m.watchdogFired || m.mustRestart(err))
+		m.watchdogFired = false
+		m.ready = false
+		if restart {
+			m.state = stateRestarting
+		}
+		m.mu.Unlock()
+
+		if !restart {
+			m.finish(exited, err)
+			return
+		}
+
+		log.Printf("%s exited (%v), restarting", m.name, exitStatus(err))
+		time.Sleep(restartDelay)
+
+		m.mu.Lock()
+		if m.stopping {
+			m.mu.Unlock()
+			m.finish(exited, err)
+			return
+		}
+		err = m.startProcess()
+		if err == nil {
+			m.state = stateRunning
+			m.startedAt = time.Now()
+			m.restarts++
+			m.statusText = ""
+		}
+		m.mu.Unlock()
+		m.kick()
+
+		if err != nil {
+			log.Printf("%s failed to restart: %v", m.name, err)
+			m.finish(exited, err)
+			return
+		}
+	}
+}
+
+func (m *member) finish(exited chan struct{}, err error) {
+	m.mu.Lock()
+	m.running = false
+	m.err = err
+	if m.stopping {
+		m.state = stateStopped
+	} else {
+		m.state = stateExited
+	}
+	m.mu.Unlock()
+
+	close(exited)
+}
+
+func (m *member) mustRestart(err error) bool {
+	switch m.restart {
+	case procker.RestartAlways:
+		return true
+	case procker.RestartOnFailure:
+		return err != nil
+	}
+	return false
+}
+
+func (m *member) Stop(timeout time.Duration) error {
+	m.mu.Lock()
+	if !m.running {
+		m.mu.Unlock()
+		return errors.New("procker: not started")
+	}
+	stopping := m.stopping
+	m.stopping = true
+	exited := m.exited
+	m.mu.Unlock()
+
+	if m.schedule != nil {
+		if !stopping {
+			m.cancel <- m.timeout(timeout)
+		}
+	} else if m.process.Running() {
+		m.process.Stop(m.timeout(timeout))
+	}
+	return m.wait(exited)
+}
+
+// sameAs reports whether other runs the same command, in the same
+// environment and with the same settings as m.
+func (m *member) sameAs(other *member) bool {
+	p, o := m.process, other.process
+	return m.port == other.port &&
+		m.restart == other.restart &&
+		m.stopTimeout == other.stopTimeout &&
+		scheduleSpec(m.schedule) == scheduleSpec(other.schedule) &&
+		m.overlap == other.overlap &&
+		m.notify == other.notify &&
+		m.attachable == other.attachable &&
+		m.watchdog == other.watchdog &&
+		p.Command == o.Command &&
+		p.Dir == o.Dir &&
+		reflect.DeepEqual(p.Env, o.Env) &&
+		p.StopSignal == o.StopSignal &&
+		p.Strict == o.Strict &&
+		p.Shell == o.Shell &&
+		p.ShellMode == o.ShellMode &&
+		len(p.ListenFiles) == len(o.ListenFiles)
+}
+
+func scheduleSpec(s *procker.Schedule) string {
+	if s == nil {
+		return ""
+	}
+	return s.String()
+}
+
+// timeout returns the member's stop timeout, if any, or the given one.
+func (m *member) timeout(timeout time.Duration) time.Duration {
+	if m.stopTimeout > 0 {
+		return m.stopTimeout
+	}
+	return timeout
+}
+
+func (m *member) Signal(sig os.Signal) error {
+	return m.process.Signal(sig)
+}
+
+// Wait waits for the member to finish, returning the exit error of its
+// last run. Once finished, it returns immediately.
+func (m *member) Wait() error {
+	m.mu.Lock()
+	exited := m.exited
+	m.mu.Unlock()
+
+	if exited == nil {
+		return errors.New("procker: not started")
+	}
+	return m.wait(exited)
+}
+
+func (m *member) wait(exited chan struct{}) error {
+	<-exited
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.err
+}
+
+func (m *member) Running() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.running
+}
+
+// status reports the current state of the member.
+func (m *member) status() processStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := processStatus{
+		Name:     m.name,
+		State:    m.state,
+		Port:     m.port,
+		Started:  m.startedAt,
+		Restarts: m.restarts,
+	}
+	if s.State == "" {
+		s.State = stateStopped
+	}
+	if m.state == stateRunning {
+		s.Pid = m.process.Pid()
+		s.Uptime = time.Since(m.startedAt).Seconds()
+		s.Ready = !m.notify || m.ready
+	}
+	if m.running {
+		s.Status = m.statusText
+	}
+	if m.schedule != nil && m.running {
+		s.Next = m.next
+	}
+	if m.state == stateExited || m.state == stateStopped || m.state == stateScheduled && m.err != nil {
+		s.Exit = exitStatus(m.err)
+		s.ExitCode = exitCode(m.err)
+	}
+	return s
+}
+
+// exitCounts returns how many times the process exited, by exit code.
+func (m *member) exitCounts() map[int]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	exits := make(map[int]int, len(m.exits))
+	for code, n := range m.exits {
+		exits[code] = n
+	}
+	return exits
+}
+
+// exitCode returns the exit code of a process which exited with err:
+// 128 plus the signal number for processes killed by a signal.
+func exitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	if e, ok := err.(*exec.ExitError); ok {
+		if status, ok := e.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return e.ExitCode()
+	}
+	return 1
+}
+
+func exitStatus(err error) string {
+	if err == nil {
+		return "exit status 0"
+	}
+	return err.Error()
+}
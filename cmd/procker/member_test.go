@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jweslley/procker"
+)
+
+func TestExitCode(t *testing.T) {
+	for _, c := range []struct {
+		command string
+		code    int
+		exit    string
+	}{
+		{"true", 0, "exit status 0"},
+		{"exit 3", 3, "exit status 3"},
+		{"kill -TERM $$", 128 + 15, "signal: terminated"},
+		{"kill -KILL $$", 128 + 9, "signal: killed"},
+	} {
+		m := stubMember("web", c.command)
+		m.process.ShellMode = procker.ShellAlways
+		if err := m.Start(); err != nil {
+			t.Fatal(err)
+		}
+		err := m.Wait()
+		assert(t, c.code, exitCode(err))
+
+		s := m.status()
+		assert(t, stateExited, s.State)
+		assert(t, c.exit, s.Exit)
+		assert(t, c.code, s.ExitCode)
+	}
+
+	// such as a process failing to restart
+	m := stubMember("web", "true")
+	m.state, m.err = stateExited, errors.New("procker: failed to start")
+	s := m.status()
+	assert(t, "procker: failed to start", s.Exit)
+	assert(t, 1, s.ExitCode)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+)
+
+// metric is a Prometheus metric, reported for every process.
+type metric struct {
+	name  string
+	kind  string
+	help  string
+	value func(m *member, s processStatus) (float64, bool)
+}
+
+var metrics = []metric{
+	{"procker_process_up", "gauge", "Whether the process is running.",
+		func(m *member, s processStatus) (float64, bool) {
+			return boolValue(s.State == stateRunning), true
+		}},
+	{"procker_process_ready", "gauge", "Whether the process is ready.",
+		func(m *member, s processStatus) (float64, bool) {
+			return boolValue(s.Ready), true
+		}},
+	{"procker_process_restarts_total", "counter", "Number of times the process was restarted.",
+		func(m *member, s processStatus) (float64, bool) {
+			return float64(s.Restarts), true
+		}},
+	{"procker_process_uptime_seconds", "gauge", "Time since the process was started.",
+		func(m *member, s processStatus) (float64, bool) {
+			return s.Uptime, true
+		}},
+	{"procker_process_cpu_seconds_total", "counter", "User and system CPU time spent by the process.",
+		func(m *member, s processStatus) (float64, bool) {
+			cpu, _, ok := processUsage(s.Pid)
+			return cpu, ok && s.Pid != 0
+		}},
+	{"procker_process_resident_memory_bytes", "gauge", "Resident memory size of the process.",
+		func(m *member, s processStatus) (float64, bool) {
+			_, rss, ok := processUsage(s.Pid)
+			return float64(rss), ok && s.Pid != 0
+		}},
+	{"procker_process_output_lines_total", "counter", "Lines of output emitted by the process.",
+		func(m *member, s processStatus) (float64, bool) {
+			return float64(m.output.total()), true
+		}},
+}
+
+// writeMetrics writes the metrics of mg's members in the Prometheus
+// text exposition format.
+func writeMetrics(w io.Writer, mg *manager) {
+	members := mg.list()
+	statuses := make([]processStatus, len(members))
+	for i, m := range members {
+		statuses[i] = m.status()
+	}
+
+	for _, metric := range metrics {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", metric.name, metric.help, metric.name, metric.kind)
+		for i, m := range members {
+			if value, ok := metric.value(m, statuses[i]); ok {
+				fmt.Fprintf(w, "%s{process=%q} %s\n", metric.name, m.name, formatValue(value))
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "# HELP procker_process_exits_total Number of times the process exited, by exit code.\n")
+	fmt.Fprintf(w, "# TYPE procker_process_exits_total counter\n")
+	for _, m := range members {
+		exits := m.exitCounts()
+		codes := make([]int, 0, len(exits))
+		for code := range exits {
+			codes = append(codes, code)
+		}
+		sort.Ints(codes)
+		for _, code := range codes {
+			fmt.Fprintf(w, "procker_process_exits_total{process=%q,code=\"%d\"} %d\n", m.name, code, exits[code])
+		}
+	}
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	web := stubMember("web", "sleep 10")
+	failing := stubMember("failing", "echo failing; exit 3")
+	failing.process.Stdout = failing.output
+	done := stubMember("done", "true")
+
+	mg := newManager([]*member{web, failing, done}, time.Second)
+	if err := mg.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		mg.Stop(time.Second)
+		mg.Wait()
+	}()
+	failing.Wait()
+	done.Wait()
+	assert(t, nil, mg.do("start", []string{"failing"}))
+	failing.Wait()
+
+	api := &httpAPI{mg: mg, host: "localhost", port: "5999"}
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	r.Host = "localhost:5999"
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, r)
+	assert(t, http.StatusOK, w.Code)
+
+	lines := make(map[string]bool)
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		lines[line] = true
+	}
+	for _, line := range []string{
+		"# TYPE procker_process_up gauge",
+		`procker_process_up{process="web"} 1`,
+		`procker_process_up{process="failing"} 0`,
+		`procker_process_ready{process="web"} 1`,
+		"# TYPE procker_process_restarts_total counter",
+		`procker_process_restarts_total{process="web"} 0`,
+		`procker_process_output_lines_total{process="failing"} 2`,
+		"# TYPE procker_process_exits_total counter",
+		`procker_process_exits_total{process="failing",code="3"} 2`,
+		`procker_process_exits_total{process="done",code="0"} 1`,
+	} {
+		if !lines[line] {
+			t.Errorf("missing %s in:\n%s", line, w.Body.String())
+		}
+	}
+
+	// usage is only reported for running processes
+	for line := range lines {
+		if strings.HasPrefix(line, "procker_process_cpu_seconds_total") ||
+			strings.HasPrefix(line, "procker_process_resident_memory_bytes") {
+			assert(t, true, strings.Contains(line, `{process="web"}`))
+		}
+		if strings.HasPrefix(line, "procker_process_exits_total") {
+			assert(t, false, strings.Contains(line, `{process="web"`))
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/jweslley/procker"
+)
+
+// notifyDir is the directory holding the notify sockets of processes.
+var notifyDir struct {
+	once sync.Once
+	path string
+	err  error
+}
+
+func notifySocketPath(name string) (string, error) {
+	notifyDir.once.Do(func() {
+		notifyDir.path, notifyDir.err = ioutil.TempDir("", "procker")
+	})
+	return filepath.Join(notifyDir.path, name+".sock"), notifyDir.err
+}
+
+// removeNotifySockets removes the notify sockets directory.
+func removeNotifySockets() {
+	if notifyDir.path != "" {
+		os.RemoveAll(notifyDir.path)
+	}
+}
+
+// listenNotify creates the notify socket of a member declaring notify
+// or a watchdog, unless created already. Must be called with m.mu held.
+func (m *member) listenNotify() error {
+	if m.notifier != nil {
+		return nil
+	}
+
+	path, err := notifySocketPath(m.name)
+	if err != nil {
+		return err
+	}
+	notifier, err := procker.ListenNotify(path)
+	if err != nil {
+		return err
+	}
+
+	m.notifier = notifier
+	m.keepAlive = make(chan struct{}, 1)
+	m.process.NotifySocket = path
+	go m.receiveNotifications(notifier.Notifications)
+	return nil
+}
+
+func (m *member) receiveNotifications(notifications <-chan procker.Notification) {
+	for n := range notifications {
+		m.mu.Lock()
+		if n["READY"] == "1" && !m.ready {
+			m.ready = true
+			log.Printf("%s is ready", m.name)
+		}
+		if status, ok := n["STATUS"]; ok && status != m.statusText {
+			m.statusText = status
+			log.Printf("%s status: %s", m.name, status)
+		}
+		if n["STOPPING"] == "1" {
+			m.ready = false
+			log.Printf("%s is stopping", m.name)
+		}
+		m.mu.Unlock()
+
+		switch n["WATCHDOG"] {
+		case "1":
+			m.kick()
+		case "trigger":
+			m.watchdogTimeout()
+		}
+	}
+}
+
+// kick resets the watchdog timer.
+func (m *member) kick() {
+	select {
+	case m.keepAlive <- struct{}{}:
+	default:
+	}
+}
+
+// runWatchdog restarts the process when no keep-alive is received
+// within the watchdog interval, until exited is closed.
+func (m *member) runWatchdog(exited chan struct{}) {
+	timer := time.NewTimer(m.watchdog)
+	defer timer.Stop()
+	for {
+		select {
+		case <-m.keepAlive:
+		case <-timer.C:
+			m.watchdogTimeout()
+		case <-exited:
+			return
+		}
+
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(m.watchdog)
+	}
+}
+
+// watchdogTimeout stops the process, which is restarted whatever
+// its restart policy.
+func (m *member) watchdogTimeout() {
+	m.mu.Lock()
+	if m.stopping || !m.process.Running() {
+		m.mu.Unlock()
+		return
+	}
+	m.watchdogFired = true
+	m.mu.Unlock()
+
+	log.Printf("%s watchdog timeout, restarting", m.name)
+	go m.process.Stop(m.stopTimeout)
+}
+
+// close releases the member's notify socket.
+func (m *member) close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.notifier != nil {
+		m.notifier.Close()
+		m.notifier = nil
+	}
+}
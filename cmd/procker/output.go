@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// attachBacklog is the number of writes queued for an attached writer
+// which doesn't keep up with the output, before it is dropped.
+const attachBacklog = 256
+
+// maxLineLength is the length at which output without newline is kept as
+// a line of its own, so a process never writing one doesn't grow the
+// buffer without bounds.
+const maxLineLength = 64 * 1024
+
+// outputBuffer is an io.Writer keeping the last lines written to it,
+// and copying them to the writers attached to it.
+type outputBuffer struct {
+	mu      sync.Mutex
+	size    int
+	lines   []string
+	partial []byte
+	count   int64
+	writers map[*attachedWriter]bool
+}
+
+// attachedWriter copies the writes queued for it from its own goroutine,
+// so a slow writer never blocks the process writing the output.
+type attachedWriter struct {
+	w      io.Writer
+	writes chan []byte
+}
+
+func newOutputBuffer(size int) *outputBuffer {
+	return &outputBuffer{size: size}
+}
+
+func (b *outputBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	data := append(b.partial, p...)
+	for {
+		i, next := bytes.IndexByte(data, '\n'), 0
+		switch {
+		case i >= 0 && i <= maxLineLength:
+			next = i + 1
+		case len(data) >= maxLineLength:
+			i, next = maxLineLength, maxLineLength
+		}
+		if next == 0 {
+			break
+		}
+		b.lines = append(b.lines, string(data[:i]))
+		b.count++
+		data = data[next:]
+	}
+	if len(b.lines) > b.size {
+		b.lines = append([]string{}, b.lines[len(b.lines)-b.size:]...)
+	}
+	b.partial = append([]byte{}, data...)
+
+	for w := range b.writers {
+		select {
+		case w.writes <- append([]byte{}, p...):
+		default:
+			// fell behind: drop it
+			b.detach(w)
+			if c, ok := w.w.(io.Closer); ok {
+				c.Close()
+			}
+		}
+	}
+	return len(p), nil
+}
+
+// attach copies what is written from now on to w, until detached,
+// a write to w fails or w falls behind by more than attachBacklog
+// writes, in which case w is closed if it is an io.Closer.
+func (b *outputBuffer) attach(w io.Writer) (detach func()) {
+	aw := &attachedWriter{w: w, writes: make(chan []byte, attachBacklog)}
+
+	b.mu.Lock()
+	if b.writers == nil {
+		b.writers = make(map[*attachedWriter]bool)
+	}
+	b.writers[aw] = true
+	b.mu.Unlock()
+
+	go func() {
+		failed := false
+		for p := range aw.writes {
+			if failed {
+				continue
+			}
+			if _, err := w.Write(p); err != nil {
+				failed = true
+				b.mu.Lock()
+				b.detach(aw)
+				b.mu.Unlock()
+			}
+		}
+	}()
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.detach(aw)
+	}
+}
+
+// detach stops copying the output to w. Must be called with b.mu held.
+func (b *outputBuffer) detach(w *attachedWriter) {
+	if b.writers[w] {
+		delete(b.writers, w)
+		close(w.writes)
+	}
+}
+
+// last returns up to n of the last lines written.
+func (b *outputBuffer) last(n int) []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if n <= 0 || n > len(b.lines) {
+		n = len(b.lines)
+	}
+	return append([]string{}, b.lines[len(b.lines)-n:]...)
+}
+
+// total returns the number of lines written so far.
+func (b *outputBuffer) total() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.count
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputBufferKeepsLastLines(t *testing.T) {
+	b := newOutputBuffer(2)
+	b.Write([]byte("one\ntwo\nthr"))
+	b.Write([]byte("ee\nfour"))
+
+	assert(t, []string{"two", "three"}, b.last(0))
+	assert(t, []string{"three"}, b.last(1))
+	assert(t, int64(3), b.total())
+}
+
+func TestOutputBufferCapsLines(t *testing.T) {
+	b := newOutputBuffer(10)
+	long := strings.Repeat("x", maxLineLength)
+	b.Write([]byte(long[:100]))
+	b.Write([]byte(long[100:] + "yz"))
+	assert(t, []string{long}, b.last(0))
+	assert(t, 2, len(b.partial))
+
+	b.Write([]byte("\n" + long + "xy\n"))
+	assert(t, []string{long, "yz", long, "xy"}, b.last(0))
+	assert(t, 0, len(b.partial))
+}
+
+func TestOutputBufferCopiesToAttachedWriters(t *testing.T) {
+	b := newOutputBuffer(10)
+	r, w := io.Pipe()
+	detach := b.attach(w)
+	defer detach()
+
+	b.Write([]byte("hello\n"))
+	line, err := bufio.NewReader(r).ReadString('\n')
+	assert(t, nil, err)
+	assert(t, "hello\n", line)
+}
+
+// stuckWriter never completes a write, until closed.
+type stuckWriter struct {
+	closed chan struct{}
+}
+
+func (w *stuckWriter) Write(p []byte) (int, error) {
+	<-w.closed
+	return 0, io.ErrClosedPipe
+}
+
+func (w *stuckWriter) Close() error {
+	close(w.closed)
+	return nil
+}
+
+func TestOutputBufferDropsSlowWriters(t *testing.T) {
+	b := newOutputBuffer(10)
+	w := &stuckWriter{closed: make(chan struct{})}
+	b.attach(w)
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < attachBacklog+2; i++ {
+			b.Write([]byte("line\n"))
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writes blocked by a slow writer")
+	}
+	select {
+	case <-w.closed:
+	default:
+		t.Error("slow writer must be closed")
+	}
+	assert(t, 0, len(b.writers))
+}
@@ -0,0 +1,36 @@
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+// clockTicks is the number of clock ticks per second (getconf CLK_TCK)
+// used by /proc to report CPU times.
+const clockTicks = 100
+
+// processUsage reads the CPU time (in seconds) and the resident
+// memory (in bytes) of a process from /proc.
+func processUsage(pid int) (cpu float64, rss int64, ok bool) {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0, 0, false
+	}
+
+	// fields after the command name, which may contain spaces
+	i := strings.LastIndexByte(string(stat), ')')
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 22 {
+		return 0, 0, false
+	}
+
+	var utime, stime, pages int64
+	fmt.Sscan(fields[11], &utime)
+	fmt.Sscan(fields[12], &stime)
+	fmt.Sscan(fields[21], &pages)
+	return float64(utime+stime) / clockTicks, pages * int64(os.Getpagesize()), true
+}
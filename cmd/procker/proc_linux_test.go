@@ -0,0 +1,33 @@
+// +build linux
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestProcessUsage(t *testing.T) {
+	// spend some CPU time
+	var usage syscall.Rusage
+	for start := time.Now(); time.Since(start) < 5*time.Second; {
+		syscall.Getrusage(syscall.RUSAGE_SELF, &usage)
+		if time.Duration(usage.Utime.Nano()+usage.Stime.Nano()) > 100*time.Millisecond {
+			break
+		}
+	}
+
+	cpu, rss, ok := processUsage(os.Getpid())
+	assert(t, true, ok)
+	if expected := float64(usage.Utime.Nano()+usage.Stime.Nano()) / 1e9; cpu < expected-0.05 {
+		t.Errorf("expected at least %.2fs of CPU time, actual %.2fs", expected, cpu)
+	}
+	if rss < 1<<20 {
+		t.Errorf("expected at least 1 MiB of resident memory, actual %d bytes", rss)
+	}
+
+	_, _, ok = processUsage(-1)
+	assert(t, false, ok)
+}
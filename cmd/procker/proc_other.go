@@ -0,0 +1,8 @@
+// +build !linux
+
+package main
+
+// processUsage is only supported on Linux.
+func processUsage(pid int) (cpu float64, rss int64, ok bool) {
+	return 0, 0, false
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log"
+	"sync"
+
+	"github.com/jweslley/procker"
+)
+
+// reloader updates the processes of a running procker start, and the
+// files they watch, from its Procfile and env files.
+type reloader struct {
+	mg           *manager
+	processNames []string
+	dir          string
+	padding      int
+
+	mu       sync.Mutex
+	watchers []*procker.Watcher
+}
+
+// reload reads the Procfile and env files again, updating the processes.
+// Nothing changes when they can't be read.
+func (r *reloader) reload() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	processes, err := loadProcesses(*startProcfile)
+	if err != nil {
+		log.Printf("reload failed: %s", errorMessage(err))
+		return
+	}
+
+	env, err := startEnv.layers(startEnvfiles)
+	if err != nil {
+		log.Printf("reload failed: %s", errorMessage(err))
+		return
+	}
+
+	members, err := buildMembers(r.processNames, processes, r.dir, env, *startBasePort, r.padding)
+	if err != nil {
+		// close the sockets bound for the new members
+		releaseSockets(r.mg.list())
+		log.Printf("reload failed: %s", errorMessage(err))
+		return
+	}
+
+	if err := r.mg.reload(members); err != nil {
+		log.Printf("reload: %v", err)
+	}
+	releaseSockets(r.mg.list())
+
+	r.closeWatchers()
+	if err := r.watchLocked(processes); err != nil {
+		log.Printf("reload: %s", errorMessage(err))
+	}
+	log.Printf("reloaded")
+}
+
+// watch restarts processes when the files they watch change.
+func (r *reloader) watch(processes []procker.ProcessConfig) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.watchLocked(processes)
+}
+
+func (r *reloader) watchLocked(processes []procker.ProcessConfig) error {
+	watchers, err := watchProcesses(r.mg, processes, r.processNames, r.dir, startWatch)
+	r.watchers = watchers
+	return err
+}
+
+func (r *reloader) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closeWatchers()
+}
+
+func (r *reloader) closeWatchers() {
+	for _, w := range r.watchers {
+		w.Close()
+	}
+	r.watchers = nil
+}
@@ -2,7 +2,11 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"os"
+	"os/signal"
+	"path"
+	"regexp"
 	"strings"
 
 	"github.com/jweslley/procker"
@@ -11,18 +15,59 @@ import (
 var (
 	cmdRun = &command{
 		desc: "Run a command using your application's environment",
-		help: `Usage: procker run COMMAND
+		help: `Usage: procker run [options] COMMAND
+       procker run [options] PROCESS [-- ARGS...]
 
 Run a command using your application's environment
 
+When the first argument names a process of the Procfile, its command is
+run instead, followed by the given arguments, in the process's directory
+and environment: its env files and variables, PORT and PS are set just
+like 'procker start' does for the process's first instance, or for the
+instance named, such as web.2. Commands are run as given when the default
+Procfile is missing or invalid.
+
+  procker run release
+  procker run web.2 -- --verbose
+
+Signals received by procker run, all of those which can be caught but
+SIGCHLD and SIGURG, are forwarded to the command, and procker waits for
+it to exit.
+Keyboard signals (Ctrl-C, Ctrl-\, Ctrl-Z) reach the command from the
+terminal directly, and SIGTSTP, SIGTTIN and SIGTTOU suspend procker along
+with the command, until both are continued (SIGCONT).
+procker run exits with the exit code of the command, or 128 plus the
+signal number if the command was killed by a signal.
+
+Env files are layered in the given order (-e .env -e .env.local or
+-e .env,.env.local), later files overriding earlier ones. When PROCKER_ENV
+is set, each env file F is followed by its F.$PROCKER_ENV overlay, if any.
+
+The environment of the command is made of the following layers, each one
+overriding the previous ones (-debug-env prints them):
+
+  1. procker's own environment, unless -only-env is given (PROCKER_ENV
+     still selects env file overlays)
+  2. env files given by -e (.env by default) and their overlays
+  3. for processes run by name, their env_file and env settings
+  4. variables given by -E KEY=VALUE, taken literally
+  5. for processes run by name, PORT and PS
+
 Available options:`,
 		exec: run,
 		flag: runFlags}
 
 	// flags
-	runFlags   = flag.NewFlagSet("run", flag.ExitOnError)
-	runEnvfile = runFlags.String("e", defaultEnvfile,
-		"File containing environment variables to be used")
+	runFlags    = flag.NewFlagSet("run", flag.ExitOnError)
+	runProcfile = runFlags.String("f", "Procfile",
+		"Procfile (or procker.yml) declaring processes which may be run by name")
+	runEnvfiles = envFlag(runFlags)
+	runEnv      = envOptionFlags(runFlags)
+	runBasePort = runFlags.Int("p", 5000,
+		"Base port used to compute the PORT of processes run by name")
+	runStrict = runFlags.Bool("strict", false,
+		"Fail when the command references undefined variables")
+	runShell = shellFlags(runFlags)
 )
 
 func run(args []string) {
@@ -30,18 +75,132 @@ func run(args []string) {
 		fail("you must specify a command. See 'procker help run'.\n")
 	}
 
-	env := parseEnv(*runEnvfile)
-	command := strings.Join(args, " ")
+	env, err := runEnv.layers(runEnvfiles)
+	failIf(err)
+
+	name, layers := "command", concatLayers(env, []envLayer{runEnv.overrides()})
 	process := &procker.SysProcess{
-		Command: command,
-		Env:     env,
-		Stdin:   os.Stdin,
-		Stdout:  os.Stdout,
-		Stderr:  os.Stderr,
+		Command:   strings.Join(args, " "),
+		Stdin:     os.Stdin,
+		Stdout:    os.Stdout,
+		Stderr:    os.Stderr,
+		Strict:    *runStrict,
+		Shell:     runShell.shell,
+		ShellMode: runShell.mode,
 	}
 
-	err := process.Start()
+	if i, ok := findInstance(runProcesses(args[0]), args[0], *runBasePort); ok {
+		extra := args[1:]
+		if len(extra) > 0 && extra[0] == "--" {
+			extra = extra[1:]
+		}
+
+		dir := path.Dir(*runProcfile)
+		process.Command = appendArgs(i.config.Command, extra)
+		process.Dir = processDir(dir, i.config.Dir)
+		processEnv, err := processEnvLayers(env, dir, i.config, runEnv)
+		failIf(err)
+		name, layers = i.name, concatLayers(processEnv, []envLayer{instanceEnvLayer(i)})
+	}
+
+	process.Env = flattenEnv(layers)
+	if runEnv.debug {
+		writeEnvLayers(os.Stderr, name, layers)
+	}
+
+	c := make(chan os.Signal, 8)
+	signal.Notify(c, forwardedSignals...)
+
+	err = process.Start()
 	failIf(err)
 
-	process.Wait()
+	go forwardSignals(c, process)
+
+	err = process.Wait()
+	os.Exit(exitCode(err))
+}
+
+// forwardSignals sends the signals received by procker to process,
+// except for keyboard signals when attached to a terminal, which the
+// process already receives from the terminal. Signals suspending the
+// process suspend procker as well.
+func forwardSignals(c <-chan os.Signal, process *procker.SysProcess) {
+	terminal := isTerminal(os.Stdin)
+	for sig := range c {
+		if !terminal || !containsSignal(keyboardSignals, sig) {
+			process.Signal(sig)
+		}
+		if containsSignal(suspendSignals, sig) {
+			suspend()
+		}
+	}
+}
+
+func containsSignal(signals []os.Signal, sig os.Signal) bool {
+	for _, s := range signals {
+		if s == sig {
+			return true
+		}
+	}
+	return false
+}
+
+// isTerminal reports whether f is a terminal.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// runNameRegexp matches the names of processes and of their instances.
+var runNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_-]*(\.[0-9]+)?$`)
+
+// runProcesses returns the processes of the Procfile, if name could be
+// one of theirs. Unless the Procfile is given by -f, commands are run as
+// given when it's missing or invalid.
+func runProcesses(name string) []procker.ProcessConfig {
+	if !runNameRegexp.MatchString(name) {
+		return nil
+	}
+
+	processes, err := loadProcesses(*runProcfile)
+	if err != nil && !flagSet(runFlags, "f") {
+		if !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "procker: ignoring %s (%s)\n", *runProcfile, errorMessage(err))
+		}
+		return nil
+	}
+	if err != nil {
+		fail("%s\n", errorMessage(err))
+	}
+	return processes
+}
+
+// findInstance returns the instance of processes named name: web.2 names
+// the second instance of web, and web its first instance.
+func findInstance(processes []procker.ProcessConfig, name string, port int) (instance, bool) {
+	for _, i := range instances(processes, nil, port) {
+		if i.name == name || i.config.Name == name {
+			return i, true
+		}
+	}
+	return instance{}, false
+}
+
+// appendArgs appends args to command, quoted for the shell.
+func appendArgs(command string, args []string) string {
+	for _, arg := range args {
+		command += " " + shellQuote(arg)
+	}
+	return command
+}
+
+// flagSet reports whether the named flag was given.
+func flagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
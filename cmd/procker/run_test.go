@@ -0,0 +1,65 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/jweslley/procker"
+)
+
+func TestAppendArgs(t *testing.T) {
+	for _, c := range []struct {
+		args     []string
+		expected string
+	}{
+		{nil, "rake"},
+		{[]string{"db:migrate", "VERSION=42"}, "rake db:migrate VERSION=42"},
+		{[]string{"a b", "it's", "$HOME", ""}, `rake 'a b' 'it'\''s' '$HOME' ''`},
+	} {
+		assert(t, c.expected, appendArgs("rake", c.args))
+	}
+}
+
+func TestFindInstance(t *testing.T) {
+	processes := []procker.ProcessConfig{
+		{Name: "web", Command: "puma", Instances: 2},
+		{Name: "worker", Command: "rake jobs:work", Instances: 1},
+		{Name: "admin", Command: "puma", Instances: 2, Port: 9000},
+	}
+
+	for _, c := range []struct {
+		name string
+		env  []string
+	}{
+		{"web", []string{"PORT=5000", "PS=web.1"}},
+		{"web.2", []string{"PORT=5001", "PS=web.2"}},
+		{"worker", []string{"PORT=5002", "PS=worker"}},
+		{"admin.2", []string{"PORT=9001", "PS=admin.2"}},
+		{"web.3", nil},
+		{"worker.1", nil},
+		{"ls", nil},
+	} {
+		i, ok := findInstance(processes, c.name, 5000)
+		assert(t, c.env != nil, ok)
+		if ok {
+			assert(t, c.env, instanceEnvLayer(i).vars)
+		}
+	}
+}
+
+func TestRunProcessesFallsBackToCommands(t *testing.T) {
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+
+	inTempDir(t, map[string]string{"Procfile": "web: puma\n"}, func(dir string) {
+		assert(t, 1, len(runProcesses("web")))
+		assert(t, 0, len(runProcesses("./bin/setup")))
+	})
+	inTempDir(t, map[string]string{"Procfile": "web puma\n"}, func(dir string) {
+		assert(t, 0, len(runProcesses("web")))
+	})
+	inTempDir(t, nil, func(dir string) {
+		assert(t, 0, len(runProcesses("web")))
+	})
+}
@@ -0,0 +1,68 @@
+// +build !windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// forwardedSignals are the signals procker run forwards to the command:
+// every signal which can be caught, but SIGCHLD and SIGURG, which report
+// procker's own children and sockets, and are used by the Go runtime.
+var forwardedSignals = []os.Signal{
+	syscall.SIGHUP,
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+	syscall.SIGILL,
+	syscall.SIGTRAP,
+	syscall.SIGABRT,
+	syscall.SIGBUS,
+	syscall.SIGFPE,
+	syscall.SIGUSR1,
+	syscall.SIGSEGV,
+	syscall.SIGUSR2,
+	syscall.SIGPIPE,
+	syscall.SIGALRM,
+	syscall.SIGTERM,
+	syscall.SIGCONT,
+	syscall.SIGTSTP,
+	syscall.SIGTTIN,
+	syscall.SIGTTOU,
+	syscall.SIGXCPU,
+	syscall.SIGXFSZ,
+	syscall.SIGVTALRM,
+	syscall.SIGPROF,
+	syscall.SIGWINCH,
+	syscall.SIGIO,
+	syscall.SIGSYS,
+}
+
+// keyboardSignals are sent by the terminal to its whole foreground
+// process group, which the command belongs to.
+var keyboardSignals = []os.Signal{
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+	syscall.SIGTSTP,
+	syscall.SIGTTIN,
+	syscall.SIGTTOU,
+}
+
+// suspendSignals stop procker run along with the command, as they would
+// stop procker if they weren't caught, keeping job control working.
+var suspendSignals = []os.Signal{syscall.SIGTSTP, syscall.SIGTTIN, syscall.SIGTTOU}
+
+// suspend stops procker until it receives SIGCONT.
+func suspend() {
+	syscall.Kill(os.Getpid(), syscall.SIGSTOP)
+}
+
+// resumeSignals continue processes suspended by suspendSignals.
+var resumeSignals = []os.Signal{syscall.SIGCONT}
+
+// suspendProcesses stops the processes of mg, then procker itself, until
+// it receives SIGCONT.
+func suspendProcesses(mg *manager) {
+	mg.Signal(syscall.SIGSTOP)
+	suspend()
+}
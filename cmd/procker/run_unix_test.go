@@ -0,0 +1,33 @@
+// +build !windows
+
+package main
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRunForwardsSignals(t *testing.T) {
+	cmd := prockerCommand("run", "sh", "../../test/trapsignals.sh")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer cmd.Process.Kill()
+
+	readLine := lineReader(t, stdout, 5*time.Second)
+	assert(t, "ready", readLine())
+
+	cmd.Process.Signal(syscall.SIGHUP)
+	assert(t, "hup", readLine())
+	cmd.Process.Signal(syscall.SIGUSR1)
+	assert(t, "usr1", readLine())
+
+	cmd.Process.Signal(syscall.SIGTERM)
+	err = cmd.Wait()
+	assert(t, 128+int(syscall.SIGTERM), exitCode(err))
+}
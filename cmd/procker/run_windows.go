@@ -0,0 +1,22 @@
+// +build windows
+
+package main
+
+import "os"
+
+// forwardedSignals are the signals procker run forwards to the command.
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// keyboardSignals are sent by the console to all processes attached
+// to it, the command included.
+var keyboardSignals = []os.Signal{os.Interrupt}
+
+// suspendSignals stop procker run along with the command.
+var suspendSignals []os.Signal
+
+func suspend() {}
+
+// resumeSignals continue processes suspended by suspendSignals.
+var resumeSignals []os.Signal
+
+func suspendProcesses(mg *manager) {}
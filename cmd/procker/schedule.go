@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/jweslley/procker"
+)
+
+// startSchedule runs the process at the scheduled times, until stopped.
+// Must be called with m.mu held.
+func (m *member) startSchedule() {
+	m.running = true
+	m.stopping = false
+	m.state = stateScheduled
+	m.exited = make(chan struct{})
+	m.cancel = make(chan time.Duration)
+	go m.runSchedule(m.exited, m.cancel)
+}
+
+func (m *member) runSchedule(exited chan struct{}, cancel chan time.Duration) {
+	runs := make(chan error, 1)
+	running := false
+	queued := 0
+	var last error
+
+	run := func() {
+		m.mu.Lock()
+		err := m.startProcess()
+		if err == nil {
+			m.state = stateRunning
+			m.startedAt = time.Now()
+		}
+		m.mu.Unlock()
+
+		if err != nil {
+			log.Printf("%s failed to start: %v", m.name, err)
+			return
+		}
+		log.Printf("running %s (schedule %s)", m.name, m.schedule)
+		running = true
+		go func() {
+			runs <- m.process.Wait()
+		}()
+	}
+
+	timer := time.NewTimer(m.untilNext())
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			timer.Reset(m.untilNext())
+			if !running {
+				run()
+				continue
+			}
+
+			switch m.overlap {
+			case procker.OverlapQueue:
+				log.Printf("%s is still running, queueing next run", m.name)
+				queued++
+			case procker.OverlapKill:
+				log.Printf("%s is still running, stopping it", m.name)
+				queued = 1
+				go m.process.Stop(m.stopTimeout)
+			default:
+				log.Printf("%s is still running, skipping run", m.name)
+			}
+
+		case err := <-runs:
+			running = false
+			last = err
+			log.Printf("%s exited (%v)", m.name, exitStatus(err))
+
+			m.mu.Lock()
+			if m.exits == nil {
+				m.exits = make(map[int]int)
+			}
+			m.exits[exitCode(err)]++
+			m.err = err
+			m.state = stateScheduled
+			m.mu.Unlock()
+
+			if queued > 0 {
+				queued--
+				run()
+			}
+
+		case timeout := <-cancel:
+			if running {
+				m.process.Stop(timeout)
+				last = <-runs
+			}
+			m.finish(exited, last)
+			return
+		}
+	}
+}
+
+// untilNext returns the time until the next scheduled run.
+func (m *member) untilNext() time.Duration {
+	next := m.schedule.Next(time.Now())
+
+	m.mu.Lock()
+	m.next = next
+	m.mu.Unlock()
+
+	if next.IsZero() {
+		// never: wait until stopped
+		return time.Duration(1<<63 - 1)
+	}
+	return time.Until(next)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/jweslley/procker"
+)
+
+// shellOptions holds the flags selecting how commands are run.
+type shellOptions struct {
+	shell string
+	mode  procker.ShellMode
+}
+
+func shellFlags(flags *flag.FlagSet) *shellOptions {
+	o := &shellOptions{}
+	flags.StringVar(&o.shell, "shell", procker.DefaultShell,
+		"Shell used to run commands")
+	flags.Var(o, "shell-mode",
+		"When to run commands through the shell: auto (if using shell syntax), always or never")
+	return o
+}
+
+func (o *shellOptions) String() string {
+	if o == nil {
+		return "auto"
+	}
+	switch o.mode {
+	case procker.ShellAlways:
+		return "always"
+	case procker.ShellNever:
+		return "never"
+	}
+	return "auto"
+}
+
+func (o *shellOptions) Set(value string) error {
+	switch value {
+	case "auto":
+		o.mode = procker.ShellAuto
+	case "always":
+		o.mode = procker.ShellAlways
+	case "never":
+		o.mode = procker.ShellNever
+	default:
+		return fmt.Errorf("invalid shell mode '%s'", value)
+	}
+	return nil
+}
+
+// uses reports whether command is run through the shell.
+func (o *shellOptions) uses(command string) bool {
+	switch o.mode {
+	case procker.ShellAlways:
+		return true
+	case procker.ShellNever:
+		return false
+	}
+	return procker.NeedsShell(command)
+}
+
+// shellQuote quotes s for the shell, unless it only holds characters
+// which need no quoting.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+,./:@%") == "" {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// sockets holds the listening sockets bound by procker, by port. They're
+// kept across restarts and reloads, so connections wait in the socket's
+// backlog while a process is down, and the port can't be taken meanwhile.
+var sockets = struct {
+	sync.Mutex
+	files map[int]*os.File
+}{files: make(map[int]*os.File)}
+
+// listenSocket returns a socket listening on port, binding it on host
+// if needed.
+func listenSocket(host string, port int) (*os.File, error) {
+	sockets.Lock()
+	defer sockets.Unlock()
+
+	if file, ok := sockets.files[port]; ok {
+		return file, nil
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, err
+	}
+	// the file holds a duplicate of the listener's socket
+	defer listener.Close()
+
+	file, err := listener.(*net.TCPListener).File()
+	if err != nil {
+		return nil, err
+	}
+	sockets.files[port] = file
+	return file, nil
+}
+
+// releaseSockets closes the sockets not passed to any of the members.
+func releaseSockets(members []*member) {
+	sockets.Lock()
+	defer sockets.Unlock()
+
+	used := make(map[*os.File]bool)
+	for _, m := range members {
+		for _, file := range m.process.ListenFiles {
+			used[file] = true
+		}
+	}
+
+	for port, file := range sockets.files {
+		if !used[file] {
+			file.Close()
+			delete(sockets.files, port)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/signal"
@@ -13,7 +15,8 @@ import (
 	"github.com/jweslley/procker"
 )
 
-const defaultEnvfile = ".env"
+// outputLines is the number of output lines kept for each process.
+const outputLines = 1000
 
 var (
 	cmdStart = &command{
@@ -22,6 +25,98 @@ var (
 
 Start the processes specified by a Procfile
 
+A file with the .yml or .yaml extension is read in the extended format,
+which declares per process settings:
+
+  web:
+    command: bundle exec thin start -p $PORT
+    dir: ./web
+    env:
+      RAILS_ENV: development
+    env_file: [.env.web]
+    port: 3000
+    stop_signal: SIGINT
+    stop_timeout: 10s
+    restart: on-failure   # no, always or on-failure
+    instances: 2
+    watch: ["**/*.rb", config/*.yml]
+    watch_ignore: [tmp, log]
+    socket: true          # pass the socket bound on PORT
+    notify: true          # ready once READY=1 is sent to $NOTIFY_SOCKET
+    watchdog: 30s         # restart unless WATCHDOG=1 is sent that often
+    attach: true          # keep stdin open for 'procker attach'
+  cleanup:
+    command: bundle exec rake cleanup
+    schedule: "*/5 * * * *"   # cron expression, @daily or @every 10m
+    overlap: skip             # skip, queue or kill a run still running
+
+Scheduled processes run at the given times rather than being kept running,
+logging their exit status after each run.
+
+Processes declaring socket, or all processes but scheduled ones when
+-socket is given, get their PORT bound by procker before being started,
+on 127.0.0.1 unless another address is given by -socket-host.
+The listening socket is passed as file descriptor 3 using the systemd
+socket activation protocol (LISTEN_FDS and LISTEN_PID), and kept open
+across restarts so no connection is refused while a process restarts.
+
+Processes declaring notify or a watchdog may send sd_notify messages to
+the socket named by their NOTIFY_SOCKET variable: READY=1 once ready,
+STATUS= to report a status shown by 'procker ps', STOPPING=1 when
+stopping, and WATCHDOG=1 keep-alives (the watchdog interval is given by
+WATCHDOG_USEC).
+
+Env files are layered in the given order (-e .env -e .env.local or
+-e .env,.env.local), later files overriding earlier ones. When PROCKER_ENV
+is set, each env file F is followed by its F.$PROCKER_ENV overlay, if any.
+
+The environment of each process is made of the following layers, each one
+overriding the previous ones (-debug-env prints them):
+
+  1. procker's own environment, unless -only-env is given (PROCKER_ENV
+     still selects env file overlays)
+  2. env files given by -e (.env by default) and their overlays
+  3. the process's env_file and env settings
+  4. variables given by -E KEY=VALUE, taken literally
+  5. PORT, PS and WATCHDOG_USEC, set by procker
+
+While running, processes can be listed, stopped, started and restarted
+using 'procker ps', 'procker stop', 'procker start' and 'procker restart'
+(given the same Procfile), and 'procker attach' sends the terminal's input
+to a process declaring attach (or any process, with -attach), as its
+stdin. Procker exits once no process is running, with the exit code of
+the first process which exited on its own with a non-zero code (128 plus
+the signal number for processes killed by a signal), or 0.
+
+procker stops processes gracefully on SIGINT (Ctrl-C) and SIGTERM, killing
+them if a second signal is received. SIGQUIT logs the status of all
+processes, and SIGHUP reloads the Procfile and env files: new processes
+are started, removed ones are stopped, and processes whose command,
+environment or settings changed are restarted, leaving the others running.
+SIGTSTP (Ctrl-Z), SIGTTIN and SIGTTOU suspend the processes along with
+procker, until procker is continued (SIGCONT).
+
+Processes declaring watch patterns, or all processes when -w is given, are
+restarted when files matching the patterns change under their directory.
+Patterns without '/' match file names at any depth, and "**" matches any
+number of directories: -w '*.go' -w 'templates/**'.
+
+With -http, procker serves a JSON API to inspect and control processes:
+
+  GET  /processes                  list processes
+  GET  /processes/NAME             show a process
+  GET  /processes/NAME/output?n=N  last N lines of output (default 100)
+  POST /processes/NAME/start       start a process (stop, restart alike)
+  POST /processes/NAME/signal?signal=HUP
+                                   send a signal to a process
+  GET  /metrics                    metrics in the Prometheus text format
+
+Requests must be addressed to the host procker listens on (or an IP
+address or localhost, on its port), and POST requests must carry an
+X-Procker header, so web pages can't control processes:
+
+  curl -X POST -H 'X-Procker: 1' localhost:5999/processes/web/restart
+
 Available options:`,
 		exec: start,
 		flag: startFlags}
@@ -29,80 +124,251 @@ Available options:`,
 	// flags
 	startFlags    = flag.NewFlagSet("start", flag.ExitOnError)
 	startProcfile = startFlags.String("f", "Procfile",
-		"Procfile declaring commands to run")
-	startEnvfile = startFlags.String("e", defaultEnvfile,
-		"File containing environment variables to be used")
+		"Procfile (or procker.yml) declaring commands to run")
+	startEnvfiles = envFlag(startFlags)
+	startEnv      = envOptionFlags(startFlags)
 	startBasePort = startFlags.Int("p", 5000,
 		"Base port to be used by processes")
 	startStopTimeout = startFlags.Int("t", 5,
 		"Time (in seconds) for graceful stop of processes")
+	startStrict = startFlags.Bool("strict", false,
+		"Fail when commands reference undefined variables")
+	startShell = shellFlags(startFlags)
+	startHTTP  = startFlags.String("http", "",
+		"Address to serve the HTTP API on, e.g. localhost:5999 or :5999 (localhost)")
+	startHTTPToken = startFlags.String("http-token", os.Getenv("PROCKER_HTTP_TOKEN"),
+		"Token required by the HTTP API, as a bearer token or token parameter")
+	startWatch  = watchFlags(startFlags)
+	startSocket = startFlags.Bool("socket", false,
+		"Bind processes' ports and pass the listening sockets to them (socket activation)")
+	startAttach = startFlags.Bool("attach", false,
+		"Keep processes' stdin open for 'procker attach'")
+	startSocketHost = startFlags.String("socket-host", "127.0.0.1",
+		"Address processes' sockets are bound on, e.g. 0.0.0.0 for all interfaces")
 )
 
 func start(args []string) {
+	os.Exit(startProcesses(args))
+}
+
+// startProcesses runs the processes until none is running, returning
+// the exit code procker must exit with.
+func startProcesses(args []string) int {
+	socket := controlSocket(*startProcfile)
+	if controlRunning(socket) {
+		// an instance is already running: start the given processes there
+		if len(args) == 0 {
+			fail("already running. See 'procker help start'.\n")
+		}
+		control(socket, "start", args)
+		return 0
+	}
+
 	processes := parseProfile(*startProcfile)
-	env := parseEnv(*startEnvfile)
+	env, err := startEnv.layers(startEnvfiles)
+	failIf(err)
 	dir := path.Dir(*startProcfile)
 	padding := longestName(processes)
 	log.SetFlags(0)
 	log.SetOutput(procker.NewPrefixedWriter(os.Stdout, prefix(programName, padding)))
 	process := buildProcess(args, processes, dir, env, *startBasePort, padding)
 
+	listener, err := listenControl(socket, process)
+	failIf(err)
+	defer listener.Close()
+
+	defer removeNotifySockets()
+
+	reloader := &reloader{mg: process, processNames: args, dir: dir, padding: padding}
+	failIf(reloader.watch(processes))
+	defer reloader.close()
+
+	if *startHTTP != "" {
+		addr, err := serveHTTP(*startHTTP, *startHTTPToken, process)
+		failIf(err)
+		log.Printf("serving HTTP API on http://%s", addr)
+	}
+
+	handleSignals(process, reloader.reload)
+
+	err = process.Start()
+	failIf(err)
+
+	process.Wait()
+	return process.exitStatus()
+}
+
+// handleSignals stops processes on SIGINT and SIGTERM, killing them on
+// a second signal, reloads them on SIGHUP and logs their status on
+// SIGQUIT.
+func handleSignals(mg *manager, reload func()) {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signals := []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT}
+	signal.Notify(c, append(append(signals, suspendSignals...), resumeSignals...)...)
 	go func() {
 		stopping := false
 		for sig := range c {
-			if stopping {
+			switch {
+			case containsSignal(suspendSignals, sig):
+				log.Printf("%v signal received, suspending processes.", sig)
+				suspendProcesses(mg)
+			case containsSignal(resumeSignals, sig):
+				log.Printf("%v signal received, resuming processes.", sig)
+				mg.Signal(sig)
+			case sig == syscall.SIGQUIT:
+				log.Printf("%v signal received, processes status:", sig)
+				writeStatus(log.Writer(), mg.status())
+			case sig == syscall.SIGHUP:
+				if stopping {
+					continue
+				}
+				log.Printf("%v signal received, reloading processes.", sig)
+				go reload()
+			case stopping:
 				log.Printf("%v signal received, killing processes and exiting.", sig)
-				process.Signal(syscall.SIGKILL)
-			} else {
+				mg.Signal(syscall.SIGKILL)
+			default:
 				log.Printf("%v signal received, stopping processes and exiting.", sig)
 				stopping = true
 				go func() {
-					process.Stop(time.Duration(*startStopTimeout) * time.Second)
+					mg.Stop(time.Duration(*startStopTimeout) * time.Second)
 				}()
 			}
 		}
 	}()
+}
+
+func buildProcess(
+	processNames []string,
+	processes []procker.ProcessConfig,
+	dir string,
+	env []envLayer,
+	port, padding int) *manager {
 
-	err := process.Start()
+	members, err := buildMembers(processNames, processes, dir, env, port, padding)
 	failIf(err)
 
-	process.Wait()
+	for _, m := range members {
+		if m.schedule != nil {
+			log.Printf("scheduling %s (%s)", m.name, m.schedule)
+		} else {
+			log.Printf("starting %s on port %d", m.name, m.port)
+		}
+	}
+
+	return newManager(members, time.Duration(*startStopTimeout)*time.Second)
 }
 
-func buildProcess(
+// buildMembers creates the members running the instances of the
+// processes named by processNames, or of all processes, on top of the
+// env layers shared by all processes.
+func buildMembers(
 	processNames []string,
-	processes map[string]string,
+	processes []procker.ProcessConfig,
 	dir string,
-	env []string,
-	port, padding int) procker.Process {
+	env []envLayer,
+	port, padding int) ([]*member, error) {
 
-	p := []procker.Process{}
-	for name, command := range processes {
-		if !mustStart(processNames, name) {
-			continue
+	p := []*member{}
+	envs := make(map[string][]envLayer)
+	for _, i := range instances(processes, processNames, port) {
+		config := i.config
+		if _, ok := envs[config.Name]; !ok {
+			layers, err := processEnvLayers(env, dir, config, startEnv)
+			if err != nil {
+				return nil, err
+			}
+			envs[config.Name] = layers
+		}
+
+		instanceEnv := instanceEnvLayer(i)
+		if config.Watchdog > 0 {
+			instanceEnv.vars = append(instanceEnv.vars,
+				fmt.Sprintf("WATCHDOG_USEC=%d", config.Watchdog/time.Microsecond))
+		}
+		layers := concatLayers(envs[config.Name], []envLayer{instanceEnv})
+		if startEnv.debug {
+			writeEnvLayers(log.Writer(), i.name, layers)
 		}
 
+		output := newOutputBuffer(outputLines)
 		process := &procker.SysProcess{
-			Command:     command,
-			Dir:         dir,
-			Env:         append(env, fmt.Sprintf("PORT=%d", port)),
-			Stdout:      procker.NewPrefixedWriter(os.Stdout, prefix(name, padding)),
-			Stderr:      procker.NewPrefixedWriter(os.Stderr, prefix(name, padding)),
+			Command:     config.Command,
+			Dir:         processDir(dir, config.Dir),
+			Env:         flattenEnv(layers),
+			Stdout:      io.MultiWriter(procker.NewPrefixedWriter(os.Stdout, prefix(i.name, padding)), output),
+			Stderr:      io.MultiWriter(procker.NewPrefixedWriter(os.Stderr, prefix(i.name, padding)), output),
 			SysProcAttr: sysProcAttrs(),
+			StopSignal:  config.StopSignal,
+			Strict:      *startStrict,
+			Shell:       startShell.shell,
+			ShellMode:   startShell.mode,
 		}
 
-		log.Printf("starting %s on port %d", name, port)
-		p = append(p, process)
-		port++
+		if config.Socket || *startSocket && config.Schedule == nil {
+			file, err := listenSocket(*startSocketHost, i.port)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %s", i.name, errorMessage(err))
+			}
+			process.ListenFiles = []*os.File{file}
+		}
+
+		m := &member{
+			name:        i.name,
+			port:        i.port,
+			restart:     config.Restart,
+			stopTimeout: config.StopTimeout,
+			schedule:    config.Schedule,
+			overlap:     config.Overlap,
+			notify:      config.Notify,
+			watchdog:    config.Watchdog,
+			attachable:  config.Attach || *startAttach,
+			process:     process,
+			output:      output,
+		}
+		if m.stopTimeout == 0 {
+			// processes stopped by procker itself, such as scheduled
+			// runs or processes missing their watchdog, get the usual
+			// time to stop gracefully
+			m.stopTimeout = time.Duration(*startStopTimeout) * time.Second
+		}
+		p = append(p, m)
 	}
 
 	if len(p) == 0 {
-		fail("no process to run\n")
+		return nil, errors.New("no process to run")
 	}
+	return p, nil
+}
 
-	return procker.NewProcessGroup(p...)
+// instance is a running copy of a process, with its own name and port.
+type instance struct {
+	name   string
+	port   int
+	config procker.ProcessConfig
+}
+
+// instances lists the instances of the processes named by processNames,
+// or of all processes if none is named, assigning ports from port onwards
+// to processes which don't declare their own.
+func instances(processes []procker.ProcessConfig, processNames []string, port int) []instance {
+	var list []instance
+	for _, config := range processes {
+		if !mustStart(processNames, config.Name) {
+			continue
+		}
+
+		for i := 1; i <= config.Instances; i++ {
+			processPort := port
+			if config.Port != 0 {
+				processPort = config.Port + i - 1
+			} else {
+				port++
+			}
+			list = append(list, instance{instanceName(config, i), processPort, config})
+		}
+	}
+	return list
 }
 
 func mustStart(processNames []string, name string) bool {
@@ -118,36 +384,72 @@ func mustStart(processNames []string, name string) bool {
 	return false
 }
 
-func parseProfile(filepath string) map[string]string {
-	file, err := os.Open(filepath)
-	failIf(err)
-	defer file.Close()
-
-	processes, err := procker.ParseProcfile(file)
+func parseProfile(filepath string) []procker.ProcessConfig {
+	processes, err := loadProcesses(filepath)
 	failIf(err)
 	return processes
 }
 
-func parseEnv(filepath string) []string {
+// loadProcesses reads a Procfile, or a procker.yml in the extended format.
+func loadProcesses(filepath string) ([]procker.ProcessConfig, error) {
 	file, err := os.Open(filepath)
 	if err != nil {
-		if filepath == defaultEnvfile {
-			return os.Environ()
-		} else {
-			failIf(err)
-		}
+		return nil, err
 	}
 	defer file.Close()
 
-	env, err := procker.ParseEnv(file)
-	failIf(err)
-	return append(os.Environ(), env...)
+	switch path.Ext(filepath) {
+	case ".yml", ".yaml":
+		return procker.ParseConfig(file, filepath)
+	}
+
+	entries, err := procker.ParseProcfileEntries(file, filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	processes := []procker.ProcessConfig{}
+	for _, entry := range entries {
+		processes = append(processes, procker.ProcessConfig{
+			Name:      entry.Name,
+			Command:   entry.Command,
+			Instances: 1,
+		})
+	}
+	return processes, nil
+}
+
+// processDir resolves p relative to dir, the Procfile's directory.
+func processDir(dir, p string) string {
+	if p == "" {
+		return dir
+	}
+	if path.IsAbs(p) {
+		return p
+	}
+	return path.Join(dir, p)
+}
+
+// concat returns a new slice holding the elements of all given slices.
+func concat(slices ...[]string) []string {
+	var s []string
+	for _, slice := range slices {
+		s = append(s, slice...)
+	}
+	return s
+}
+
+func instanceName(config procker.ProcessConfig, i int) string {
+	if config.Instances <= 1 {
+		return config.Name
+	}
+	return fmt.Sprintf("%s.%d", config.Name, i)
 }
 
-func longestName(processes map[string]string) int {
+func longestName(processes []procker.ProcessConfig) int {
 	max := len(programName)
-	for name := range processes {
-		if len(name) > max {
+	for _, config := range processes {
+		if name := instanceName(config, config.Instances); len(name) > max {
 			max = len(name)
 		}
 	}
@@ -0,0 +1,77 @@
+// +build linux
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStartSuspendsProcesses(t *testing.T) {
+	inTempDir(t, map[string]string{
+		"Procfile": "web: echo $$ > web.pid; exec sleep 30\nworker: echo $$ > worker.pid; exec sleep 30\n",
+	}, func(dir string) {
+		cmd := prockerCommand("start")
+		cmd.Env = append(cmd.Env, "XDG_RUNTIME_DIR="+dir)
+		if err := cmd.Start(); err != nil {
+			t.Fatal(err)
+		}
+		defer cmd.Process.Kill()
+
+		pids := []int{cmd.Process.Pid, readPid(t, "web.pid"), readPid(t, "worker.pid")}
+		waitState(t, pids, "S")
+
+		cmd.Process.Signal(syscall.SIGTSTP)
+		waitState(t, pids, "T")
+
+		cmd.Process.Signal(syscall.SIGCONT)
+		waitState(t, pids, "S")
+
+		cmd.Process.Signal(syscall.SIGTERM)
+		assert(t, nil, cmd.Wait())
+	})
+}
+
+// readPid reads the pid written to file, waiting for it to be written.
+func readPid(t *testing.T, file string) int {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		content, _ := ioutil.ReadFile(file)
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(content))); err == nil {
+			return pid
+		}
+	}
+	t.Fatalf("no pid written to %s", file)
+	return 0
+}
+
+// waitState waits for the processes to be in the given state, as
+// reported by /proc: S for sleeping, T for stopped.
+func waitState(t *testing.T, pids []int, state string) {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		states := processStates(pids)
+		if strings.Count(states, state) == len(pids) {
+			return
+		}
+	}
+	t.Fatalf("expected processes %v to be in state %s, actual: %s", pids, state, processStates(pids))
+}
+
+func processStates(pids []int) string {
+	var states string
+	for _, pid := range pids {
+		stat, _ := ioutil.ReadFile(filepath.Join("/proc", fmt.Sprint(pid), "stat"))
+		if i := strings.LastIndexByte(string(stat), ')'); i >= 0 && i+2 < len(stat) {
+			states += string(stat[i+2])
+		} else {
+			states += "?"
+		}
+	}
+	return states
+}
+
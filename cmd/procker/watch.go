@@ -0,0 +1,103 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jweslley/procker"
+)
+
+// listFlag is a flag.Value holding a list of values, given by repeating
+// the flag or as a comma-separated list.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	if l == nil {
+		return ""
+	}
+	return strings.Join(*l, ",")
+}
+
+func (l *listFlag) Set(value string) error {
+	for _, s := range strings.Split(value, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			*l = append(*l, s)
+		}
+	}
+	return nil
+}
+
+// watchOptions are the flags controlling the watch mode.
+type watchOptions struct {
+	patterns listFlag
+	ignore   listFlag
+	delay    time.Duration
+}
+
+func watchFlags(flags *flag.FlagSet) *watchOptions {
+	o := &watchOptions{ignore: listFlag{".git", ".hg", ".svn"}}
+	flags.Var(&o.patterns, "w",
+		"Restart processes when files matching the pattern change (repeatable)")
+	flags.Var(&o.ignore, "watch-ignore",
+		"Ignore changes to files or directories matching the pattern (repeatable)")
+	flags.DurationVar(&o.delay, "watch-delay", 500*time.Millisecond,
+		"Time to wait for changes to settle before restarting processes")
+	return o
+}
+
+// watchProcesses restarts the named processes, or all of them, when the
+// files they watch change. Processes declaring no watch patterns watch
+// the patterns given by -w, if any.
+func watchProcesses(
+	mg *manager,
+	processes []procker.ProcessConfig,
+	processNames []string,
+	dir string,
+	options *watchOptions) ([]*procker.Watcher, error) {
+
+	var watchers []*procker.Watcher
+	for _, config := range processes {
+		if !mustStart(processNames, config.Name) || config.Instances == 0 {
+			continue
+		}
+
+		patterns := config.Watch
+		if len(patterns) == 0 {
+			patterns = options.patterns
+		}
+		if len(patterns) == 0 {
+			continue
+		}
+
+		w, err := procker.NewWatcher(processDir(dir, config.Dir), patterns,
+			concat(options.ignore, config.WatchIgnore), options.delay)
+		if err != nil {
+			for _, w := range watchers {
+				w.Close()
+			}
+			return nil, err
+		}
+		watchers = append(watchers, w)
+
+		go func(name string, events <-chan []string) {
+			for files := range events {
+				log.Printf("%s changed, restarting %s", describeFiles(files), name)
+				if err := mg.restart([]string{name}); err != nil {
+					log.Printf("failed to restart %s: %v", name, err)
+				}
+			}
+		}(config.Name, w.Events)
+	}
+	return watchers, nil
+}
+
+// describeFiles lists the first changed files.
+func describeFiles(files []string) string {
+	const max = 3
+	if len(files) <= max {
+		return strings.Join(files, ", ")
+	}
+	return strings.Join(files[:max], ", ") + " and others"
+}
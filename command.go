@@ -0,0 +1,149 @@
+package procker
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// NewCommand creates a exec.Cmd from cmd, splitting it in words using
+// shell-style rules for quoting, escaping, and spaces, and then expanding
+// parameters in each word using expander (which may be nil). Expanded
+// values never change word boundaries: a value containing spaces, quotes
+// or glob characters is kept as is in a single argument. Parameters inside
+// single quotes are not expanded.
+//
+// As in NewShellCommand, environment variables specified at the start of
+// cmd are extracted.
+func NewCommand(cmd string, expander *Expander) (*exec.Cmd, error) {
+	words, err := splitWords(cmd, expander)
+	if err != nil {
+		return nil, err
+	}
+
+	var env []string
+	args := []string{}
+	for _, w := range words {
+		if len(args) == 0 && w.assignment {
+			env = append(env, w.value)
+		} else {
+			args = append(args, w.value)
+		}
+	}
+	if len(args) == 0 {
+		return nil, errors.New("procker: empty command")
+	}
+
+	c := exec.Command(args[0], args[1:]...)
+	c.Env = env
+	return c, nil
+}
+
+type word struct {
+	value      string
+	assignment bool
+}
+
+// splitWords splits cmd in words, expanding parameters in unquoted and
+// double-quoted text. A '#' starting a word begins a comment.
+func splitWords(cmd string, expander *Expander) ([]word, error) {
+	var words []word
+	var undefined []string
+	var buf strings.Builder
+	inWord, quoted, assignment := false, false, false
+
+	end := func() {
+		if inWord && (buf.Len() > 0 || quoted) {
+			words = append(words, word{value: buf.String(), assignment: assignment})
+		}
+		buf.Reset()
+		inWord, quoted = false, false
+	}
+	expand := func(s string) (int, error) {
+		ref, w := parameterRef(s)
+		if w == 0 || expander == nil {
+			buf.WriteByte('$')
+			return 0, nil
+		}
+		value, err := expander.parameter(ref, &undefined)
+		if err != nil {
+			return 0, fmt.Errorf("procker: %s", err)
+		}
+		buf.WriteString(value)
+		return w, nil
+	}
+
+	for i := 0; i < len(cmd); i++ {
+		c := cmd[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			end()
+			continue
+		case c == '#' && !inWord:
+			i = len(cmd)
+			continue
+		}
+
+		if !inWord {
+			// leading VAR=value words are assignments
+			assignment = envvarRegexp.MatchString(cmd[i:]) &&
+				(len(words) == 0 || words[len(words)-1].assignment)
+		}
+		inWord = true
+
+		switch c {
+		case '\\':
+			if i+1 < len(cmd) {
+				i++
+				buf.WriteByte(cmd[i])
+			}
+		case '\'':
+			quoted = true
+			n := strings.IndexByte(cmd[i+1:], '\'')
+			if n < 0 {
+				return nil, errors.New("procker: unterminated single-quoted string")
+			}
+			buf.WriteString(cmd[i+1 : i+1+n])
+			i += n + 1
+		case '"':
+			quoted = true
+			for i++; ; i++ {
+				if i >= len(cmd) {
+					return nil, errors.New("procker: unterminated double-quoted string")
+				}
+				c := cmd[i]
+				if c == '"' {
+					break
+				}
+				switch {
+				case c == '\\' && i+1 < len(cmd) && strings.IndexByte("\"\\$`", cmd[i+1]) >= 0:
+					i++
+					buf.WriteByte(cmd[i])
+				case c == '$':
+					w, err := expand(cmd[i+1:])
+					if err != nil {
+						return nil, err
+					}
+					i += w
+				default:
+					buf.WriteByte(c)
+				}
+			}
+		case '$':
+			w, err := expand(cmd[i+1:])
+			if err != nil {
+				return nil, err
+			}
+			i += w
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	end()
+
+	if expander != nil && expander.Strict && len(undefined) > 0 {
+		return nil, &UndefinedError{undefined}
+	}
+	return words, nil
+}
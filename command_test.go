@@ -0,0 +1,66 @@
+package procker
+
+import (
+	"testing"
+)
+
+func TestCommandExpandsAfterSplitting(t *testing.T) {
+	e := NewExpander([]string{
+		"APP_ROOT=/Users/Jane Doe/app",
+		`GREETING=say "hi" 'there'`,
+		"PATTERN=*.log [a-z]?",
+		"EMPTY=",
+	})
+
+	cmd, err := NewCommand(`ruby $APP_ROOT/main.rb "$GREETING" $PATTERN $EMPTY "$EMPTY" '$APP_ROOT'`, e)
+
+	assert(t, nil, err)
+	assert(t, []string{
+		"ruby",
+		"/Users/Jane Doe/app/main.rb",
+		`say "hi" 'there'`,
+		"*.log [a-z]?",
+		"",
+		"$APP_ROOT",
+	}, cmd.Args)
+}
+
+func TestCommandExpandsAssignments(t *testing.T) {
+	e := NewExpander([]string{"APP_ROOT=/Users/Jane Doe/app"})
+
+	cmd, err := NewCommand(`LOG=$APP_ROOT/log/app.log PID="$APP_ROOT/pids" ./bin/app -l $LOG`, e)
+
+	assert(t, nil, err)
+	assert(t, []string{"./bin/app", "-l"}, cmd.Args)
+	assert(t, []string{"LOG=/Users/Jane Doe/app/log/app.log", "PID=/Users/Jane Doe/app/pids"}, cmd.Env)
+}
+
+func TestCommandEscapesAndComments(t *testing.T) {
+	e := NewExpander([]string{"NAME=procker"})
+
+	cmd, err := NewCommand(`echo \$NAME "\$NAME \"$NAME\"" a\ b # $NAME`, e)
+
+	assert(t, nil, err)
+	assert(t, []string{"echo", "$NAME", `$NAME "procker"`, "a b"}, cmd.Args)
+}
+
+func TestCommandReportsErrors(t *testing.T) {
+	e := NewExpander(nil)
+	e.Strict = true
+
+	for cmd, expected := range map[string]string{
+		"":                      "procker: empty command",
+		"A=1 B=2":               "procker: empty command",
+		"echo 'open":            "procker: unterminated single-quoted string",
+		`echo "open`:            "procker: unterminated double-quoted string",
+		`echo $A "$B" '$C' $A`:  "procker: undefined variables: A, B",
+		`echo ${A:?is missing}`: "procker: A: is missing",
+	} {
+		_, err := NewCommand(cmd, e)
+		if err == nil {
+			t.Errorf("must not create command %q", cmd)
+			continue
+		}
+		assert(t, expected, err.Error())
+	}
+}
@@ -0,0 +1,296 @@
+package procker
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Restart policies accepted by ProcessConfig.
+const (
+	RestartNever     = "no"
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+)
+
+// Overlap policies accepted by ProcessConfig, telling what to do when
+// a scheduled process is due while its previous run is still running.
+const (
+	OverlapSkip  = "skip"
+	OverlapQueue = "queue"
+	OverlapKill  = "kill"
+)
+
+// ProcessConfig declares a process and its settings, as found in the
+// extended procker.yml format. A Procfile entry maps onto a ProcessConfig
+// having only Name and Command.
+//
+// Processes having a Schedule are run at the scheduled times instead of
+// being kept running, following their Overlap policy.
+//
+// Socket asks for the process's port to be bound by procker, passing
+// the listening socket to the process (see SysProcess.ListenFiles).
+//
+// Notify tells the process reports its readiness itself, sending READY=1
+// to its notify socket, while Watchdog is the interval within which it
+// must send WATCHDOG=1 keep-alives once started, to not be restarted.
+//
+// Attach keeps the process's stdin open, for input to be sent to it
+// later on. Processes read their stdin from the null device otherwise.
+type ProcessConfig struct {
+	Name        string
+	Command     string
+	Dir         string
+	Env         []string
+	EnvFiles    []string
+	Port        int
+	StopSignal  os.Signal
+	StopTimeout time.Duration
+	Restart     string
+	Instances   int
+	Watch       []string
+	WatchIgnore []string
+	Schedule    *Schedule
+	Overlap     string
+	Socket      bool
+	Notify      bool
+	Watchdog    time.Duration
+	Attach      bool
+}
+
+var procnameRegexp = regexp.MustCompile("^[A-Za-z0-9_][A-Za-z0-9_-]*$")
+
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var s string
+	if err := unmarshal(&s); err == nil {
+		*l = stringList{s}
+		return nil
+	}
+	return unmarshal((*[]string)(l))
+}
+
+type rawProcessConfig struct {
+	Command     string        `yaml:"command"`
+	Dir         string        `yaml:"dir"`
+	Env         yaml.MapSlice `yaml:"env"`
+	EnvFiles    stringList    `yaml:"env_file"`
+	Port        int           `yaml:"port"`
+	StopSignal  string        `yaml:"stop_signal"`
+	StopTimeout string        `yaml:"stop_timeout"`
+	Restart     string        `yaml:"restart"`
+	Instances   *int          `yaml:"instances"`
+	Watch       stringList    `yaml:"watch"`
+	WatchIgnore stringList    `yaml:"watch_ignore"`
+	Schedule    string        `yaml:"schedule"`
+	Overlap     string        `yaml:"overlap"`
+	Socket      bool          `yaml:"socket"`
+	Notify      bool          `yaml:"notify"`
+	Watchdog    string        `yaml:"watchdog"`
+	Attach      bool          `yaml:"attach"`
+}
+
+// ParseConfig parses io.Reader in the extended procker.yml format, keeping
+// the order in which processes were declared. Each top-level key names a
+// process:
+//
+//	web:
+//	  command: bundle exec thin start -p $PORT
+//	  dir: ./web
+//	  env:
+//	    RAILS_ENV: development
+//	  env_file: [.env, .env.web]
+//	  port: 3000
+//	  stop_signal: SIGINT
+//	  stop_timeout: 10s
+//	  restart: on-failure
+//	  instances: 2
+//	  watch: ["**/*.rb", config/*.yml]
+//	  watch_ignore: [tmp, log]
+//	  socket: true
+//	  notify: true
+//	  watchdog: 30s
+//	  attach: true
+//	cleanup:
+//	  command: bundle exec rake cleanup
+//	  schedule: "*/5 * * * *"
+//	  overlap: skip
+//
+// The filename is only used to report errors.
+func ParseConfig(r io.Reader, filename string) ([]ProcessConfig, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("procker: parse config error: %s", err)
+	}
+
+	var doc yaml.MapSlice
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("procker: %s: %s", filename, err)
+	}
+
+	var configs []ProcessConfig
+	seen := make(map[string]bool)
+	for _, item := range doc {
+		name := fmt.Sprint(item.Key)
+		if !procnameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("procker: %s: invalid process name '%s'", filename, name)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("procker: %s: duplicate process name '%s'", filename, name)
+		}
+		seen[name] = true
+
+		// round trip each process through the strict decoder to catch typos
+		out, err := yaml.Marshal(item.Value)
+		if err != nil {
+			return nil, fmt.Errorf("procker: %s: %s: %s", filename, name, err)
+		}
+		var raw rawProcessConfig
+		if err := yaml.UnmarshalStrict(out, &raw); err != nil {
+			return nil, fmt.Errorf("procker: %s: %s: %s", filename, name, err)
+		}
+
+		config, err := raw.build(name)
+		if err != nil {
+			return nil, fmt.Errorf("procker: %s: %s: %s", filename, name, err)
+		}
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
+
+func (raw *rawProcessConfig) build(name string) (ProcessConfig, error) {
+	c := ProcessConfig{
+		Name:        name,
+		Command:     strings.TrimSpace(raw.Command),
+		Dir:         raw.Dir,
+		EnvFiles:    raw.EnvFiles,
+		Port:        raw.Port,
+		Restart:     raw.Restart,
+		Instances:   1,
+		Watch:       raw.Watch,
+		WatchIgnore: raw.WatchIgnore,
+		Overlap:     raw.Overlap,
+		Socket:      raw.Socket,
+		Notify:      raw.Notify,
+		Attach:      raw.Attach,
+	}
+
+	if c.Command == "" {
+		return c, fmt.Errorf("missing command")
+	}
+
+	for _, item := range raw.Env {
+		value, err := envValue(item.Value)
+		if err != nil {
+			return c, fmt.Errorf("env %v: %s", item.Key, err)
+		}
+		c.Env = append(c.Env, fmt.Sprintf("%v=%s", item.Key, value))
+	}
+
+	if raw.StopSignal != "" {
+		sig, err := ParseSignal(raw.StopSignal)
+		if err != nil {
+			return c, err
+		}
+		c.StopSignal = sig
+	}
+
+	if raw.StopTimeout != "" {
+		timeout, err := parseDuration("stop timeout", raw.StopTimeout)
+		if err != nil {
+			return c, err
+		}
+		c.StopTimeout = timeout
+	}
+
+	switch c.Restart {
+	case "", RestartNever, RestartAlways, RestartOnFailure:
+	default:
+		return c, fmt.Errorf("invalid restart policy '%s'", c.Restart)
+	}
+
+	if raw.Watchdog != "" {
+		watchdog, err := parseDuration("watchdog", raw.Watchdog)
+		if err != nil {
+			return c, err
+		}
+		c.Watchdog = watchdog
+	}
+
+	if raw.Schedule != "" {
+		schedule, err := ParseSchedule(raw.Schedule)
+		if err != nil {
+			return c, errors.New(strings.TrimPrefix(err.Error(), "procker: "))
+		}
+		c.Schedule = schedule
+	}
+
+	switch c.Overlap {
+	case "":
+		if c.Schedule != nil {
+			c.Overlap = OverlapSkip
+		}
+	case OverlapSkip, OverlapQueue, OverlapKill:
+		if c.Schedule == nil {
+			return c, fmt.Errorf("overlap requires a schedule")
+		}
+	default:
+		return c, fmt.Errorf("invalid overlap policy '%s'", c.Overlap)
+	}
+
+	if raw.Instances != nil {
+		if *raw.Instances < 0 {
+			return c, fmt.Errorf("invalid instances count %d", *raw.Instances)
+		}
+		c.Instances = *raw.Instances
+	}
+
+	return c, nil
+}
+
+// envValue formats the value of an env variable, given as a YAML scalar.
+// A null value, as in "KEY:", is the empty string.
+func envValue(value interface{}) (string, error) {
+	switch value.(type) {
+	case nil:
+		return "", nil
+	case yaml.MapSlice, []interface{}, map[interface{}]interface{}:
+		return "", errors.New("value must be a string, number or boolean")
+	}
+	return fmt.Sprint(value), nil
+}
+
+// parseDuration parses a duration such as "10s", or a number of seconds.
+// The name of the setting is used to report errors.
+func parseDuration(name, s string) (time.Duration, error) {
+	if seconds, err := strconv.Atoi(s); err == nil {
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s'", name, s)
+	}
+	return d, nil
+}
+
+// ParseSignal returns the signal named by s, such as "SIGTERM" or "TERM".
+func ParseSignal(s string) (os.Signal, error) {
+	name := strings.TrimPrefix(strings.ToUpper(s), "SIG")
+	sig, ok := signals[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown signal '%s'", s)
+	}
+	return sig, nil
+}
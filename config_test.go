@@ -0,0 +1,111 @@
+package procker
+
+import (
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	r := strings.NewReader(`web:
+  command: bundle exec thin start -p $PORT
+  dir: ./web
+  env:
+    RAILS_ENV: development
+    WORKERS: 4
+    DEBUG:
+  env_file: .env.web
+  port: 3000
+  stop_signal: SIGINT
+  stop_timeout: 10s
+  restart: on-failure
+  instances: 2
+  watch: ["**/*.rb", config/*.yml]
+  watch_ignore: tmp
+  socket: true
+  notify: true
+  watchdog: 30
+  attach: true
+worker:
+  command: bundle exec rake jobs:work
+  stop_timeout: 30
+  env_file: [.env.worker, .env.local]
+cleanup:
+  command: bundle exec rake cleanup
+  schedule: "*/5 * * * *"
+`)
+
+	configs, err := ParseConfig(r, "procker.yml")
+	schedule, _ := ParseSchedule("*/5 * * * *")
+
+	assert(t, nil, err)
+	assert(t, []ProcessConfig{
+		{
+			Name:        "web",
+			Command:     "bundle exec thin start -p $PORT",
+			Dir:         "./web",
+			Env:         []string{"RAILS_ENV=development", "WORKERS=4", "DEBUG="},
+			EnvFiles:    []string{".env.web"},
+			Port:        3000,
+			StopSignal:  syscall.SIGINT,
+			StopTimeout: 10 * time.Second,
+			Restart:     RestartOnFailure,
+			Instances:   2,
+			Watch:       []string{"**/*.rb", "config/*.yml"},
+			WatchIgnore: []string{"tmp"},
+			Socket:      true,
+			Notify:      true,
+			Watchdog:    30 * time.Second,
+			Attach:      true,
+		},
+		{
+			Name:        "worker",
+			Command:     "bundle exec rake jobs:work",
+			EnvFiles:    []string{".env.worker", ".env.local"},
+			StopTimeout: 30 * time.Second,
+			Instances:   1,
+		},
+		{
+			Name:      "cleanup",
+			Command:   "bundle exec rake cleanup",
+			Instances: 1,
+			Schedule:  schedule,
+			Overlap:   OverlapSkip,
+		},
+	}, configs)
+}
+
+func TestParseConfigRejectsUnknownSettings(t *testing.T) {
+	r := strings.NewReader(`web:
+  command: bundle exec thin start
+  restat: always
+`)
+
+	_, err := ParseConfig(r, "procker.yml")
+	if err == nil {
+		t.Fatalf("must not parse unknown settings")
+	}
+}
+
+func TestParseConfigRejectsInvalidValues(t *testing.T) {
+	for _, config := range []string{
+		"web:\n  restart: always\n",
+		"web:\n  command: thin\n  restart: sometimes\n",
+		"web:\n  command: thin\n  stop_signal: SIGFOO\n",
+		"web:\n  command: thin\n  stop_timeout: soon\n",
+		"web:\n  command: thin\n  watchdog: often\n",
+		"web.1:\n  command: thin\n",
+		"web:\n  command: thin\n  schedule: every day\n",
+		"web:\n  command: thin\n  overlap: kill\n",
+		"web:\n  command: thin\n  schedule: \"@daily\"\n  overlap: wait\n",
+		"web:\n  command: thin\nweb:\n  command: puma\n",
+		"web:\n  command: thin\n  env:\n    HOSTS: [a, b]\n",
+		"web:\n  command: thin\n  env:\n    DB: {host: localhost}\n",
+	} {
+		_, err := ParseConfig(strings.NewReader(config), "procker.yml")
+		if err == nil {
+			t.Errorf("must not parse %q", config)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+package procker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// envParser parses dotenv files:
+//
+//	# comments and blank lines are ignored
+//	export KEY=value          # 'export' prefix is optional
+//	UNQUOTED=value $EXPANDED  # inline comments need a leading space
+//	SINGLE='no $expansion, no escapes'
+//	DOUBLE="expands ${VARS}, escapes \n \t \" \\ \$"
+//	MULTI="quoted values
+//	may span multiple lines"
+//	DEFAULT=${VAR:-default}   # see Expander for supported operators
+type envParser struct {
+	src      string
+	pos      int
+	line     int
+	filename string
+	base     map[string]string
+	expander *Expander
+}
+
+func (p *envParser) parse() ([]string, error) {
+	env := []string{}
+	local := make(map[string]string)
+	p.expander = &Expander{
+		Lookup: func(key string) (string, bool) {
+			if value, ok := local[key]; ok {
+				return value, true
+			}
+			value, ok := p.base[key]
+			return value, ok
+		},
+		Assign: func(key, value string) {
+			local[key] = value
+		},
+	}
+
+	p.line = 1
+	for {
+		p.skipBlanks()
+		if p.eof() {
+			return env, nil
+		}
+
+		switch p.peek() {
+		case '\n':
+			p.next()
+			continue
+		case '#':
+			p.skipLine()
+			continue
+		}
+
+		key, value, err := p.entry()
+		if err != nil {
+			return nil, err
+		}
+		local[key] = value
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
+	}
+}
+
+func (p *envParser) entry() (key, value string, err error) {
+	line := p.line
+	text := p.currentLine()
+
+	key = p.key()
+	if key == "export" && p.peekBlank() {
+		p.skipBlanks()
+		key = p.key()
+	}
+	if key == "" {
+		return "", "", p.errorf(line, "invalid line found: '%s'", text)
+	}
+
+	p.skipBlanks()
+	if p.eof() || p.peek() != '=' {
+		return "", "", p.errorf(line, "missing '=' after '%s'", key)
+	}
+	p.next()
+	p.skipBlanks()
+
+	if p.eof() {
+		return key, "", nil
+	}
+
+	switch p.peek() {
+	case '\'':
+		value, err = p.singleQuoted()
+	case '"':
+		value, err = p.doubleQuoted()
+	default:
+		value, err = p.unquoted()
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	p.skipBlanks()
+	if p.eof() || p.peek() == '\n' || p.peek() == '#' {
+		p.skipLine()
+		return key, value, nil
+	}
+	return "", "", p.errorf(p.line, "unexpected characters after value of '%s'", key)
+}
+
+func (p *envParser) key() string {
+	start := p.pos
+	for !p.eof() && isEnvKeyChar(p.peek(), p.pos == start) {
+		p.next()
+	}
+	return p.src[start:p.pos]
+}
+
+func (p *envParser) singleQuoted() (string, error) {
+	line := p.line
+	p.next()
+	start := p.pos
+	for !p.eof() && p.peek() != '\'' {
+		p.next()
+	}
+	if p.eof() {
+		return "", p.errorf(line, "unterminated single-quoted value")
+	}
+	value := p.src[start:p.pos]
+	p.next()
+	return value, nil
+}
+
+func (p *envParser) doubleQuoted() (string, error) {
+	line := p.line
+	p.next()
+	var value strings.Builder
+	for {
+		if p.eof() {
+			return "", p.errorf(line, "unterminated double-quoted value")
+		}
+
+		c := p.next()
+		switch c {
+		case '"':
+			return value.String(), nil
+		case '\\':
+			if p.eof() {
+				continue
+			}
+			e := p.next()
+			switch e {
+			case 'n':
+				value.WriteByte('\n')
+			case 't':
+				value.WriteByte('\t')
+			case 'r':
+				value.WriteByte('\r')
+			case '"', '\\', '$':
+				value.WriteByte(e)
+			default:
+				value.WriteByte('\\')
+				value.WriteByte(e)
+			}
+		case '$':
+			v, err := p.variable()
+			if err != nil {
+				return "", err
+			}
+			value.WriteString(v)
+		default:
+			value.WriteByte(c)
+		}
+	}
+}
+
+func (p *envParser) unquoted() (string, error) {
+	var value strings.Builder
+	for !p.eof() && p.peek() != '\n' {
+		c := p.peek()
+		if c == '#' && p.pos > 0 && isBlank(p.src[p.pos-1]) {
+			break
+		}
+		p.next()
+		if c != '$' {
+			value.WriteByte(c)
+			continue
+		}
+		v, err := p.variable()
+		if err != nil {
+			return "", err
+		}
+		value.WriteString(v)
+	}
+	return strings.TrimRight(value.String(), " \t\r"), nil
+}
+
+// variable expands a parameter reference, such as $NAME or ${NAME:-word};
+// the leading '$' has already been consumed.
+func (p *envParser) variable() (string, error) {
+	line := p.line
+	ref, w := parameterRef(p.src[p.pos:])
+	if w == 0 {
+		return "$", nil
+	}
+	for i := 0; i < w; i++ {
+		p.next()
+	}
+
+	var undefined []string
+	value, err := p.expander.parameter(ref, &undefined)
+	if err != nil {
+		return "", p.errorf(line, "%s", err)
+	}
+	return value, nil
+}
+
+func (p *envParser) currentLine() string {
+	end := strings.IndexByte(p.src[p.pos:], '\n')
+	if end < 0 {
+		return strings.TrimSpace(p.src[p.pos:])
+	}
+	return strings.TrimSpace(p.src[p.pos : p.pos+end])
+}
+
+func (p *envParser) skipBlanks() {
+	for !p.eof() && (isBlank(p.peek()) || p.peek() == '\r') {
+		p.pos++
+	}
+}
+
+func (p *envParser) skipLine() {
+	for !p.eof() && p.next() != '\n' {
+	}
+}
+
+func (p *envParser) peekBlank() bool {
+	return !p.eof() && isBlank(p.peek())
+}
+
+func (p *envParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *envParser) peek() byte {
+	return p.src[p.pos]
+}
+
+func (p *envParser) next() byte {
+	c := p.src[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+func (p *envParser) errorf(line int, format string, a ...interface{}) error {
+	return &ParseError{p.filename, line, fmt.Sprintf(format, a...)}
+}
+
+func isBlank(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+func isEnvKeyChar(c byte, first bool) bool {
+	switch {
+	case c == '_', 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z':
+		return true
+	case '0' <= c && c <= '9', c == '.':
+		return !first
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package procker
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseEnvSkipsComments(t *testing.T) {
+	r := strings.NewReader(`# database settings
+DATABASE_URL=postgres://localhost/app # inline comment
+  # indented comment
+
+COLOR=#fff`)
+
+	env, err := ParseEnv(r)
+
+	assert(t, nil, err)
+	assert(t, []string{"DATABASE_URL=postgres://localhost/app", "COLOR=#fff"}, env)
+}
+
+func TestParseEnvAcceptsExportPrefix(t *testing.T) {
+	r := strings.NewReader(`export RAILS_ENV=production
+export  QUEUE = system
+export=yes`)
+
+	env, err := ParseEnv(r)
+
+	assert(t, nil, err)
+	assert(t, []string{"RAILS_ENV=production", "QUEUE=system", "export=yes"}, env)
+}
+
+func TestParseEnvQuotedValues(t *testing.T) {
+	os.Setenv("PROCKER_TEST_HOME", "/home/case")
+	defer os.Unsetenv("PROCKER_TEST_HOME")
+
+	r := strings.NewReader(`EMPTY=
+SINGLE='hello $PROCKER_TEST_HOME \n # not a comment'
+DOUBLE="hello ${PROCKER_TEST_HOME} \"quoted\"\t\\ \$HOME" # comment
+UNQUOTED=$PROCKER_TEST_HOME/app
+PATHS="$UNQUOTED:$SINGLE"`)
+
+	env, err := ParseEnv(r)
+
+	assert(t, nil, err)
+	assert(t, []string{
+		"EMPTY=",
+		`SINGLE=hello $PROCKER_TEST_HOME \n # not a comment`,
+		"DOUBLE=hello /home/case \"quoted\"\t\\ $HOME",
+		"UNQUOTED=/home/case/app",
+		`PATHS=/home/case/app:hello $PROCKER_TEST_HOME \n # not a comment`,
+	}, env)
+}
+
+func TestParseEnvMultilineValues(t *testing.T) {
+	r := strings.NewReader(`KEY="-----BEGIN KEY-----
+abc
+-----END KEY-----"
+SCRIPT='line one
+line two'
+NEXT=value`)
+
+	env, err := ParseEnv(r)
+
+	assert(t, nil, err)
+	assert(t, []string{
+		"KEY=-----BEGIN KEY-----\nabc\n-----END KEY-----",
+		"SCRIPT=line one\nline two",
+		"NEXT=value",
+	}, env)
+}
+
+func TestParseEnvReportsErrors(t *testing.T) {
+	for input, expected := range map[string]string{
+		"A=1\nINVALID\n":         "procker: .env:2: missing '=' after 'INVALID'",
+		"A=1\n\n-B=2\n":          "procker: .env:3: invalid line found: '-B=2'",
+		"A=1\nB=\"open\n\nC=3\n": "procker: .env:2: unterminated double-quoted value",
+		"A='open\n":              "procker: .env:1: unterminated single-quoted value",
+		"A='a' b\n":              "procker: .env:1: unexpected characters after value of 'A'",
+	} {
+		_, err := ParseEnvFile(strings.NewReader(input), ".env")
+		if err == nil {
+			t.Errorf("must not parse %q", input)
+			continue
+		}
+		assert(t, expected, err.Error())
+	}
+}
+
+func TestParseEnvOverlay(t *testing.T) {
+	base := []string{"HOST=localhost", "PORT=80", "PORT=5432"}
+	r := strings.NewReader(`DATABASE_URL=postgres://$HOST:$PORT/app
+HOST=db`)
+
+	env, err := ParseEnvOverlay(r, ".env.test", base)
+
+	assert(t, nil, err)
+	assert(t, []string{"DATABASE_URL=postgres://localhost:5432/app", "HOST=db"}, env)
+}
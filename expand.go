@@ -0,0 +1,206 @@
+package procker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Expander expands shell parameters such as $VAR or ${VAR}, supporting
+// the POSIX parameter expansion operators:
+//
+//	${VAR:-word}  word if VAR is unset or empty, VAR otherwise
+//	${VAR:=word}  like :-, also assigning word to VAR
+//	${VAR:?word}  fails with word as message if VAR is unset or empty
+//	${VAR:+word}  word if VAR is set and not empty, empty otherwise
+//
+// Without the colon (${VAR-word}, ...) operators only test whether
+// VAR is unset. Words are expanded as well.
+type Expander struct {
+	// Lookup retrieves the value of a variable and whether it is set.
+	Lookup func(name string) (string, bool)
+
+	// Assign is called by ${VAR:=word} assignments, if not nil.
+	Assign func(name, value string)
+
+	// Strict makes references to unset variables an error,
+	// unless they are guarded by an operator.
+	Strict bool
+}
+
+// UndefinedError reports variables referenced but not set.
+type UndefinedError struct {
+	Names []string
+}
+
+func (e *UndefinedError) Error() string {
+	return fmt.Sprintf("procker: undefined variables: %s", strings.Join(e.Names, ", "))
+}
+
+// NewExpander creates an Expander looking up variables in env,
+// an array of strings in the form "key=value".
+func NewExpander(env []string) *Expander {
+	m := env2Map(env)
+	return &Expander{
+		Lookup: func(name string) (string, bool) {
+			value, ok := m[name]
+			return value, ok
+		},
+		Assign: func(name, value string) {
+			m[name] = value
+		},
+	}
+}
+
+// Expand replaces parameters in s. A '$' not followed by a variable
+// name or a brace is kept as is.
+func (e *Expander) Expand(s string) (string, error) {
+	var undefined []string
+	value, err := e.expand(s, &undefined)
+	if err != nil {
+		return "", fmt.Errorf("procker: %s", err)
+	}
+	if e.Strict && len(undefined) > 0 {
+		return "", &UndefinedError{undefined}
+	}
+	return value, nil
+}
+
+func (e *Expander) expand(s string, undefined *[]string) (string, error) {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '$' {
+			buf.WriteByte(s[i])
+			continue
+		}
+
+		ref, w := parameterRef(s[i+1:])
+		if w == 0 {
+			buf.WriteByte('$')
+			continue
+		}
+
+		value, err := e.parameter(ref, undefined)
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(value)
+		i += w
+	}
+	return buf.String(), nil
+}
+
+// parameter expands a parameter reference, either a variable name
+// or the content of a ${...} expression.
+func (e *Expander) parameter(ref string, undefined *[]string) (string, error) {
+	n := 0
+	for n < len(ref) && isNameChar(ref[n], n == 0) {
+		n++
+	}
+	name, op := ref[:n], ref[n:]
+	if name == "" {
+		return "", fmt.Errorf("bad substitution: ${%s}", ref)
+	}
+
+	value, set := e.Lookup(name)
+	if op == "" {
+		if !set {
+			*undefined = appendName(*undefined, name)
+		}
+		return value, nil
+	}
+
+	missing := !set
+	if op[0] == ':' {
+		missing = !set || value == ""
+		op = op[1:]
+	}
+	if op == "" {
+		return "", fmt.Errorf("bad substitution: ${%s}", ref)
+	}
+
+	word := op[1:]
+	switch op[0] {
+	case '-':
+		if missing {
+			return e.expand(word, undefined)
+		}
+		return value, nil
+	case '=':
+		if missing {
+			value, err := e.expand(word, undefined)
+			if err == nil && e.Assign != nil {
+				e.Assign(name, value)
+			}
+			return value, err
+		}
+		return value, nil
+	case '?':
+		if missing {
+			msg, err := e.expand(word, undefined)
+			if err != nil {
+				return "", err
+			}
+			if msg == "" {
+				msg = "parameter null or not set"
+			}
+			return "", fmt.Errorf("%s: %s", name, msg)
+		}
+		return value, nil
+	case '+':
+		if missing {
+			return "", nil
+		}
+		return e.expand(word, undefined)
+	}
+	return "", fmt.Errorf("bad substitution: ${%s}", ref)
+}
+
+// appendName appends name to names, unless already there.
+func appendName(names []string, name string) []string {
+	for _, n := range names {
+		if n == name {
+			return names
+		}
+	}
+	return append(names, name)
+}
+
+// parameterRef returns the parameter reference following a '$', which is
+// the content of a ${...} expression or a variable name, and its width.
+func parameterRef(s string) (string, int) {
+	if len(s) == 0 {
+		return "", 0
+	}
+
+	if s[0] == '{' {
+		depth := 0
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '{':
+				depth++
+			case '}':
+				if depth == 0 {
+					return s[1:i], i + 1
+				}
+				depth--
+			}
+		}
+		return "", 0
+	}
+
+	n := 0
+	for n < len(s) && isNameChar(s[n], n == 0) {
+		n++
+	}
+	return s[:n], n
+}
+
+func isNameChar(c byte, first bool) bool {
+	switch {
+	case c == '_', 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z':
+		return true
+	case '0' <= c && c <= '9':
+		return !first
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package procker
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpand(t *testing.T) {
+	env := []string{"HOST=localhost", "EMPTY=", "PORT=5432"}
+
+	for input, expected := range map[string]string{
+		"$HOST:$PORT":                    "localhost:5432",
+		"${HOST}_1":                      "localhost_1",
+		"${DB_URL:-postgres://$HOST/db}": "postgres://localhost/db",
+		"${EMPTY:-default}":              "default",
+		"${EMPTY-default}":               "",
+		"${MISSING-default}":             "default",
+		"${HOST:+set}/${EMPTY:+set}":     "set/",
+		"${EMPTY+set}/${MISSING+set}":    "set/",
+		"${HOST:?missing}":               "localhost",
+		"$ $1 a$":                        "$ $1 a$",
+	} {
+		actual, err := NewExpander(env).Expand(input)
+		assert(t, nil, err)
+		assert(t, expected, actual)
+	}
+}
+
+func TestExpandAssignsDefaults(t *testing.T) {
+	e := NewExpander(nil)
+
+	actual, err := e.Expand("${LOG:=/var/log/app.log} $LOG")
+
+	assert(t, nil, err)
+	assert(t, "/var/log/app.log /var/log/app.log", actual)
+}
+
+func TestExpandFailsOnRequiredVariables(t *testing.T) {
+	e := NewExpander([]string{"EMPTY="})
+
+	_, err := e.Expand("${API_KEY:?API_KEY is required}")
+	assert(t, "procker: API_KEY: API_KEY is required", err.Error())
+
+	_, err = e.Expand("${EMPTY:?}")
+	assert(t, "procker: EMPTY: parameter null or not set", err.Error())
+
+	_, err = e.Expand("${HOST:}")
+	assert(t, "procker: bad substitution: ${HOST:}", err.Error())
+}
+
+func TestExpandStrict(t *testing.T) {
+	e := NewExpander([]string{"HOST=localhost"})
+	e.Strict = true
+
+	_, err := e.Expand("$HOST:$PORT/${DB} ${USER:-app} $PORT")
+	assert(t, "procker: undefined variables: PORT, DB", err.Error())
+}
+
+func TestParseEnvExpandsParameters(t *testing.T) {
+	r := strings.NewReader(`HOST=${PROCKER_TEST_HOST:-localhost}
+URL="postgres://${HOST}/${DB:=app}"
+NAME=$DB`)
+
+	env, err := ParseEnv(r)
+
+	assert(t, nil, err)
+	assert(t, []string{"HOST=localhost", "URL=postgres://localhost/app", "NAME=app"}, env)
+
+	_, err = ParseEnvFile(strings.NewReader("A=1\nB=${PROCKER_TEST_KEY:?required}"), ".env")
+	assert(t, "procker: .env:2: PROCKER_TEST_KEY: required", err.Error())
+}
@@ -0,0 +1,46 @@
+package procker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LookPath searches for an executable named file using the PATH found in
+// env, an array of strings in the form "key=value", rather than procker's
+// own PATH, which is only used when env has no PATH. Relative paths,
+// either in file or in PATH, are resolved from dir. A file containing
+// a path separator is not searched in PATH.
+func LookPath(file, dir string, env []string) (string, error) {
+	if strings.ContainsAny(file, `/\`) {
+		path := file
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(dir, path)
+		}
+		if p, err := findExecutable(path, env); err == nil {
+			if filepath.IsAbs(file) {
+				return p, nil
+			}
+			return file + p[len(path):], nil
+		}
+		return "", fmt.Errorf("procker: %s: no such executable file", file)
+	}
+
+	pathenv, ok := env2Map(env)["PATH"]
+	if !ok {
+		pathenv = os.Getenv("PATH")
+	}
+	for _, d := range filepath.SplitList(pathenv) {
+		if d == "" {
+			d = "."
+		}
+		if !filepath.IsAbs(d) {
+			d = filepath.Join(dir, d)
+		}
+		if p, err := findExecutable(filepath.Join(d, file), env); err == nil {
+			return filepath.Abs(p)
+		}
+	}
+	return "", fmt.Errorf("procker: %s: command not found in PATH=%s", file, pathenv)
+}
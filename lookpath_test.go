@@ -0,0 +1,63 @@
+package procker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func createExecutable(t *testing.T, path, content string) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(path, []byte(content), 0755); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLookPathUsesEnvPath(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "procker")
+	defer os.RemoveAll(dir)
+	createExecutable(t, filepath.Join(dir, "node_modules/.bin/webpack"), "#!/bin/sh\n")
+	createExecutable(t, filepath.Join(dir, "bin/app"), "#!/bin/sh\n")
+
+	env := []string{"PATH=/nonexistent:node_modules/.bin"}
+
+	path, err := LookPath("webpack", dir, env)
+	assert(t, nil, err)
+	assert(t, filepath.Join(dir, "node_modules/.bin/webpack"), path)
+
+	path, err = LookPath("./bin/app", dir, env)
+	assert(t, nil, err)
+	assert(t, "./bin/app", path)
+
+	_, err = LookPath("app", dir, env)
+	assert(t, "procker: app: command not found in PATH=/nonexistent:node_modules/.bin", err.Error())
+
+	_, err = LookPath("./bin/webpack", dir, env)
+	assert(t, "procker: ./bin/webpack: no such executable file", err.Error())
+}
+
+func TestProcessStartUsingEnvPath(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "procker")
+	defer os.RemoveAll(dir)
+	createExecutable(t, filepath.Join(dir, "bin/hello"), "#!/bin/sh\necho -n hello $1\n")
+
+	stdOut := &bytes.Buffer{}
+	env := []string{"PATH=bin:" + os.Getenv("PATH")}
+
+	p := NewProcess("hello world", dir, env, stdOut, nil)
+	err := p.Start()
+	if err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	p.Wait()
+
+	assert(t, "hello world", stdOut.String())
+
+	p = NewProcess("goodbye world", dir, []string{"PATH=bin"}, stdOut, nil)
+	err = p.Start()
+	assert(t, "procker: goodbye: command not found in PATH=bin", err.Error())
+}
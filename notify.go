@@ -0,0 +1,74 @@
+package procker
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// Notification is a message sent by a process using the sd_notify
+// protocol, such as READY=1, STATUS=..., WATCHDOG=1 or STOPPING=1.
+type Notification map[string]string
+
+// NotifySocket receives the notifications sent by processes to the
+// socket named by their NOTIFY_SOCKET variable (see SysProcess).
+type NotifySocket struct {
+	Notifications <-chan Notification
+
+	path string
+	conn *net.UnixConn
+}
+
+// ListenNotify creates a notify socket at path.
+func ListenNotify(path string) (*NotifySocket, error) {
+	os.Remove(path) // stale socket
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, fmt.Errorf("procker: %s", err)
+	}
+
+	notifications := make(chan Notification)
+	s := &NotifySocket{Notifications: notifications, path: path, conn: conn}
+	go s.receive(notifications)
+	return s, nil
+}
+
+func (s *NotifySocket) receive(notifications chan<- Notification) {
+	defer close(notifications)
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := s.conn.Read(buf)
+		if err != nil {
+			return
+		}
+		if notification := ParseNotification(string(buf[:n])); len(notification) > 0 {
+			notifications <- notification
+		}
+	}
+}
+
+// Path returns the path of the socket, to be set as NOTIFY_SOCKET.
+func (s *NotifySocket) Path() string {
+	return s.path
+}
+
+// Close closes the socket, removing it.
+func (s *NotifySocket) Close() error {
+	err := s.conn.Close()
+	os.Remove(s.path)
+	return err
+}
+
+// ParseNotification parses a notification holding newline separated
+// KEY=VALUE assignments. Lines not holding an assignment are ignored.
+func ParseNotification(message string) Notification {
+	notification := make(Notification)
+	for _, line := range strings.Split(message, "\n") {
+		if i := strings.Index(line, "="); i > 0 {
+			notification[line[:i]] = line[i+1:]
+		}
+	}
+	return notification
+}
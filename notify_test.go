@@ -0,0 +1,59 @@
+package procker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseNotification(t *testing.T) {
+	n := ParseNotification("READY=1\nSTATUS=Processing requests: 2=ok\nbogus\n")
+
+	assert(t, Notification{"READY": "1", "STATUS": "Processing requests: 2=ok"}, n)
+}
+
+func TestNotifySocket(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "procker")
+	defer os.RemoveAll(dir)
+
+	s, err := ListenNotify(filepath.Join(dir, "web.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	conn, err := net.Dial("unixgram", s.Path())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write([]byte("READY=1\nSTATUS=ready"))
+
+	select {
+	case n := <-s.Notifications:
+		assert(t, Notification{"READY": "1", "STATUS": "ready"}, n)
+	case <-time.After(time.Second):
+		t.Fatal("no notification received")
+	}
+}
+
+func TestProcessNotifySocket(t *testing.T) {
+	stdOut := &bytes.Buffer{}
+	p := &SysProcess{
+		Command:      "sh -c 'echo -n $NOTIFY_SOCKET'",
+		Stdout:       stdOut,
+		NotifySocket: "/tmp/procker-web.sock",
+	}
+
+	err := p.Start()
+	if err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	p.Wait()
+
+	assert(t, "/tmp/procker-web.sock", stdOut.String())
+}
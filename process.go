@@ -33,50 +33,94 @@ type Process interface {
 
 // SysProcess represents an external command.
 // Please check exec.Cmd for more information about exported fields.
+//
+// StopSignal is the signal sent by Stop to ask the process to terminate,
+// SIGTERM if nil.
+//
+// Variables referenced by Command are expanded using Env (see Expander).
+// Strict makes Start fail when Command references undefined variables.
+//
+// ShellMode selects whether Command is run through Shell, DefaultShell
+// if empty. Commands run through a shell are expanded by the shell itself.
+//
+// ListenFiles are listening sockets passed to the process using the
+// systemd socket activation protocol: as the first extra files, starting
+// at file descriptor 3, with LISTEN_FDS and LISTEN_PID set accordingly.
+//
+// NotifySocket is the path of the socket the process may send sd_notify
+// notifications to, set as NOTIFY_SOCKET (see ListenNotify).
 type SysProcess struct {
-	Command     string
-	Dir         string
-	Env         []string
-	Stdin       io.Reader
-	Stdout      io.Writer
-	Stderr      io.Writer
-	ExtraFiles  []*os.File
-	SysProcAttr *syscall.SysProcAttr
-
+	Command      string
+	Dir          string
+	Env          []string
+	Stdin        io.Reader
+	Stdout       io.Writer
+	Stderr       io.Writer
+	ExtraFiles   []*os.File
+	SysProcAttr  *syscall.SysProcAttr
+	StopSignal   os.Signal
+	Strict       bool
+	Shell        string
+	ShellMode    ShellMode
+	ListenFiles  []*os.File
+	NotifySocket string
+
+	mu   sync.Mutex
 	cmd  *exec.Cmd
-	errc chan error
+	done chan struct{}
+	err  error
 }
 
 func (p *SysProcess) Start() error {
-	if p.Running() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cmd != nil {
 		return errors.New("procker: already started")
 	}
 
-	cmd, err := NewShellCommand(p.expandedCmd())
+	cmd, err := p.command()
 	if err != nil {
-		return fmt.Errorf("procker: invalid command: %s", err)
+		return err
 	}
 
-	p.cmd = cmd
-	p.cmd.Dir = p.Dir
-	p.cmd.Env = append(p.cmd.Env, p.Env...)
-	p.cmd.Stdin = p.Stdin
-	p.cmd.Stdout = p.Stdout
-	p.cmd.Stderr = p.Stderr
-	p.cmd.ExtraFiles = p.ExtraFiles
-	p.cmd.SysProcAttr = p.SysProcAttr
-
-	p.errc = make(chan error)
-	err = p.cmd.Start()
+	cmd.Dir = p.Dir
+	cmd.Stdin = p.Stdin
+	cmd.Stdout = p.Stdout
+	cmd.Stderr = p.Stderr
+	cmd.ExtraFiles = p.ExtraFiles
+	cmd.SysProcAttr = p.SysProcAttr
+
+	if p.NotifySocket != "" {
+		env := cmd.Env
+		if env == nil {
+			env = os.Environ()
+		}
+		cmd.Env = append(append([]string{}, env...), "NOTIFY_SOCKET="+p.NotifySocket)
+	}
+
+	if len(p.ListenFiles) > 0 {
+		if err := activate(cmd, p.ListenFiles); err != nil {
+			return err
+		}
+	}
+
+	err = cmd.Start()
 	if err != nil {
-		p.cmd = nil
 		return fmt.Errorf("procker: failed to start: %v", err)
 	}
 
+	done := make(chan struct{})
+	p.cmd = cmd
+	p.done = done
+	p.err = nil
 	go func() {
-		p.errc <- p.cmd.Wait()
-		close(p.errc)
+		err := cmd.Wait()
+		p.mu.Lock()
 		p.cmd = nil
+		p.err = err
+		p.mu.Unlock()
+		close(done)
 	}()
 	return nil
 }
@@ -94,26 +138,114 @@ func (p *SysProcess) Signal(sig os.Signal) error {
 		return errors.New("procker: not started")
 	}
 
-	return p.cmd.Process.Signal(sig)
+	return p.signal(sig)
 }
 
+// Wait waits for the process to exit, returning its exit error. It may be
+// called by several goroutines, and once the process exited, returning
+// the exit error of its last run.
 func (p *SysProcess) Wait() error {
-	if !p.Running() {
+	p.mu.Lock()
+	done := p.done
+	p.mu.Unlock()
+
+	if done == nil {
 		return errors.New("procker: not started")
 	}
 
-	return <-p.errc
+	<-done
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
 }
 
 func (p *SysProcess) Running() bool {
-	return p.cmd != nil
+	return p.process() != nil
 }
 
-func (p *SysProcess) expandedCmd() string {
-	m := env2Map(p.Env)
-	return os.Expand(p.Command, func(name string) string {
-		return m[name]
-	})
+// Pid returns the process id of the running process, or 0 if not running.
+func (p *SysProcess) Pid() int {
+	if process := p.process(); process != nil {
+		return process.Pid
+	}
+	return 0
+}
+
+// process returns the running process, or nil if not running.
+func (p *SysProcess) process() *os.Process {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.cmd == nil {
+		return nil
+	}
+	return p.cmd.Process
+}
+
+// Check reports the problems which would make Start fail: invalid
+// commands, undefined variables (in strict mode) and executables
+// which can't be found.
+func (p *SysProcess) Check() error {
+	_, err := p.command()
+	return err
+}
+
+func (p *SysProcess) command() (*exec.Cmd, error) {
+	cmd, err := p.newCmd()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Env != nil || cmd.Env != nil {
+		cmd.Env = append(append([]string{}, p.Env...), cmd.Env...)
+	}
+
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	path, err := LookPath(cmd.Args[0], p.Dir, env)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Path = path
+	cmd.Err = nil
+	return cmd, nil
+}
+
+func (p *SysProcess) newCmd() (*exec.Cmd, error) {
+	expander := NewExpander(p.Env)
+	expander.Strict = p.Strict
+
+	if !p.useShell() {
+		return NewCommand(p.Command, expander)
+	}
+
+	// the shell expands the command itself, but undefined
+	// and required variables are still reported upfront
+	if err := expandScript(p.Command, expander); err != nil {
+		return nil, err
+	}
+
+	shell := p.Shell
+	if shell == "" {
+		shell = DefaultShell
+	}
+	cmd, err := NewShellScriptCommand(shell, p.Command)
+	if err != nil {
+		return nil, fmt.Errorf("procker: invalid command: %s", err)
+	}
+	return cmd, nil
+}
+
+func (p *SysProcess) useShell() bool {
+	switch p.ShellMode {
+	case ShellAlways:
+		return true
+	case ShellNever:
+		return false
+	}
+	return NeedsShell(p.Command)
 }
 
 func (p *SysProcess) String() string {
@@ -3,6 +3,8 @@ package procker
 import (
 	"bytes"
 	"io"
+	"net"
+	"os"
 	"reflect"
 	"testing"
 	"time"
@@ -205,3 +207,73 @@ func TestProcessForceStopIfTimeoutExpires(t *testing.T) {
 	assert(t, "", stdOut.String())
 	assert(t, "", stdErr.String())
 }
+
+func TestProcessStartUsingParameterExpansion(t *testing.T) {
+	stdOut := &bytes.Buffer{}
+	stdErr := &bytes.Buffer{}
+	env := []string{"PROCKER_MSG=hello"}
+
+	p := NewProcess("echo -n $PROCKER_MSG ${PROCKER_MSG2:-world}",
+		"", env, stdOut, stdErr)
+	err := p.Start()
+
+	if err != nil {
+		t.Fatal("process failed")
+	}
+
+	err = p.Wait()
+	if err != nil {
+		t.Fatal("process failed")
+	}
+
+	assert(t, "hello world", stdOut.String())
+}
+
+func TestProcessStrictFailsOnUndefinedVariables(t *testing.T) {
+	p := &SysProcess{Command: "echo $PROCKER_MSG $PROCKER_MSG2", Strict: true}
+
+	err := p.Start()
+
+	assert(t, "procker: undefined variables: PROCKER_MSG, PROCKER_MSG2", err.Error())
+	assert(t, false, p.Running())
+}
+
+func TestProcessCheck(t *testing.T) {
+	p := &SysProcess{Command: "echo $PROCKER_MSG"}
+	assert(t, nil, p.Check())
+
+	p.Strict = true
+	assert(t, "procker: undefined variables: PROCKER_MSG", p.Check().Error())
+
+	p = &SysProcess{Command: "procker-nonexistent-command", Env: []string{"PATH=/nonexistent"}}
+	assert(t, "procker: procker-nonexistent-command: command not found in PATH=/nonexistent", p.Check().Error())
+	assert(t, false, p.Running())
+}
+
+func TestProcessListenFiles(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	file, err := listener.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	stdOut := &bytes.Buffer{}
+	p := &SysProcess{
+		Command:     `sh -c 'echo $LISTEN_FDS $(($LISTEN_PID - $$)); test -S /dev/fd/3 && echo socket'`,
+		Stdout:      stdOut,
+		ListenFiles: []*os.File{file},
+	}
+
+	err = p.Start()
+	if err != nil {
+		t.Fatalf("process failed: %v", err)
+	}
+	p.Wait()
+
+	assert(t, "1 0\nsocket\n", stdOut.String())
+}
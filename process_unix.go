@@ -3,18 +3,78 @@
 package procker
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
 	"syscall"
 	"time"
 )
 
+// DefaultShell is the shell used to run commands using shell syntax.
+var DefaultShell = "/bin/sh"
+
 func (p *SysProcess) stop(timeout time.Duration) error {
-	p.Signal(syscall.SIGTERM)
+	var sig os.Signal = syscall.SIGTERM
+	if p.StopSignal != nil {
+		sig = p.StopSignal
+	}
+	p.Signal(sig)
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- p.Wait()
+	}()
 
 	select {
-	case err := <-p.errc:
+	case err := <-exited:
 		return err
 	case <-time.After(timeout):
 		p.Signal(syscall.SIGKILL)
-		return <-p.errc
+		return <-exited
+	}
+}
+
+// signal sends sig to the process, or to its whole process group when
+// it leads one, so children of a shell are signaled as well.
+func (p *SysProcess) signal(sig os.Signal) error {
+	process := p.process()
+	if process == nil {
+		return errors.New("procker: not started")
+	}
+
+	s, ok := sig.(syscall.Signal)
+	if !ok || p.SysProcAttr == nil || !p.SysProcAttr.Setpgid {
+		return process.Signal(sig)
+	}
+	return syscall.Kill(-process.Pid, s)
+}
+
+// activate passes files to cmd using the systemd socket activation
+// protocol. LISTEN_PID must hold the pid of the command itself, which is
+// only known once started, so the command is run by a shell setting it
+// before replacing itself with the command.
+func activate(cmd *exec.Cmd, files []*os.File) error {
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(append([]string{}, env...), fmt.Sprintf("LISTEN_FDS=%d", len(files)))
+	cmd.ExtraFiles = append(append([]*os.File{}, files...), cmd.ExtraFiles...)
+
+	const script = `LISTEN_PID=$$; export LISTEN_PID; exec "$@"`
+	cmd.Args = append([]string{"/bin/sh", "-c", script, "sh", cmd.Path}, cmd.Args[1:]...)
+	cmd.Path = "/bin/sh"
+	return nil
+}
+
+func findExecutable(path string, env []string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() || info.Mode()&0111 == 0 {
+		return "", errors.New("not an executable file")
 	}
+	return path, nil
 }
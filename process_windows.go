@@ -1,10 +1,53 @@
 package procker
 
 import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 )
 
+// DefaultShell is the shell used to run commands using shell syntax.
+var DefaultShell = "cmd"
+
 func (p *SysProcess) stop(timeout time.Duration) error {
-	return p.Signal(syscall.SIGKILL)
+	if err := p.Signal(syscall.SIGKILL); err != nil {
+		return err
+	}
+	return p.Wait()
+}
+
+func (p *SysProcess) signal(sig os.Signal) error {
+	process := p.process()
+	if process == nil {
+		return errors.New("procker: not started")
+	}
+	return process.Signal(sig)
+}
+
+func activate(cmd *exec.Cmd, files []*os.File) error {
+	return errors.New("procker: socket activation not supported")
+}
+
+func findExecutable(path string, env []string) (string, error) {
+	candidates := []string{path}
+	if filepath.Ext(path) == "" {
+		pathext := env2Map(env)["PATHEXT"]
+		if pathext == "" {
+			pathext = ".com;.exe;.bat;.cmd"
+		}
+		for _, ext := range strings.Split(strings.ToLower(pathext), ";") {
+			candidates = append(candidates, path+ext)
+		}
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate, nil
+		}
+	}
+	return "", errors.New("not an executable file")
 }
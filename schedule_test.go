@@ -0,0 +1,63 @@
+package procker
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// a thursday
+	now := time.Date(2015, time.January, 1, 10, 2, 30, 0, time.UTC)
+
+	tests := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2015, time.January, 1, 10, 3, 0, 0, time.UTC)},
+		{"*/5 * * * *", time.Date(2015, time.January, 1, 10, 5, 0, 0, time.UTC)},
+		{"0 * * * *", time.Date(2015, time.January, 1, 11, 0, 0, 0, time.UTC)},
+		{"30 9 * * *", time.Date(2015, time.January, 2, 9, 30, 0, 0, time.UTC)},
+		{"0 9-17/4 * * *", time.Date(2015, time.January, 1, 13, 0, 0, 0, time.UTC)},
+		{"0 0 * * mon-fri", time.Date(2015, time.January, 2, 0, 0, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2015, time.January, 4, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * *", time.Date(2015, time.January, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 15 * sat", time.Date(2015, time.January, 3, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 feb *", time.Date(2015, time.February, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2016, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"@daily", time.Date(2015, time.January, 2, 0, 0, 0, 0, time.UTC)},
+		{"@every 90s", time.Date(2015, time.January, 1, 10, 4, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+
+	for _, test := range tests {
+		s, err := ParseSchedule(test.spec)
+		if err != nil {
+			t.Errorf("%s: %v", test.spec, err)
+			continue
+		}
+		if next := s.Next(now); !next.Equal(test.next) {
+			t.Errorf("%s: expected %v, actual %v", test.spec, test.next, next)
+		}
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	tests := map[string]string{
+		"* * * *":        "procker: invalid schedule '* * * *': expected 5 fields",
+		"60 * * * *":     "procker: invalid schedule '60 * * * *': invalid minute '60'",
+		"* * * * fun":    "procker: invalid schedule '* * * * fun': invalid day of week 'fun'",
+		"*/0 * * * *":    "procker: invalid schedule '*/0 * * * *': invalid step in minute '*/0'",
+		"* 10-2 * * *":   "procker: invalid schedule '* 10-2 * * *': invalid range in hour '10-2'",
+		"@every forever": "procker: invalid schedule '@every forever': invalid duration",
+		"@sometimes":     "procker: invalid schedule '@sometimes': expected 5 fields",
+	}
+
+	for spec, message := range tests {
+		_, err := ParseSchedule(spec)
+		if err == nil {
+			t.Errorf("%s: expected error", spec)
+			continue
+		}
+		assert(t, message, err.Error())
+	}
+}
@@ -0,0 +1,348 @@
+package procker
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// ShellMode selects whether a SysProcess runs its command through a shell.
+type ShellMode int
+
+const (
+	// ShellAuto runs commands using shell syntax, such as pipes,
+	// lists, redirections, subshells or command substitutions,
+	// through a shell, and executes other commands directly.
+	ShellAuto ShellMode = iota
+
+	// ShellAlways runs every command through a shell.
+	ShellAlways
+
+	// ShellNever executes every command directly.
+	ShellNever
+)
+
+// NeedsShell reports whether cmd uses shell syntax which can't be handled
+// without a shell: pipes, command lists, redirections, subshells, command
+// substitutions, globs or home directory expansion.
+func NeedsShell(cmd string) bool {
+	var quote byte
+	for i := 0; i < len(cmd); i++ {
+		c := cmd[i]
+		switch {
+		case c == '\\' && quote != '\'':
+			i++
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case quote == '"':
+			switch {
+			case c == '"':
+				quote = 0
+			case c == '`', c == '$' && i+1 < len(cmd) && cmd[i+1] == '(':
+				return true
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '$' && i+1 < len(cmd) && cmd[i+1] == '(':
+			return true
+		case c == '~' && (i == 0 || isBlank(cmd[i-1])):
+			return true
+		case strings.IndexByte("|&;<>()`*?[\n", c) >= 0:
+			return true
+		}
+	}
+	return false
+}
+
+// NewShellScriptCommand creates a exec.Cmd which runs cmd through the
+// given shell, using its -c option (/C for cmd.exe).
+//
+// Simple commands are run using exec, unless they run a builtin, so the
+// shell is replaced by the command and signals are delivered straight to
+// it. Environment variables specified at the start of a simple command
+// are kept in the script, for the shell to expand their values, except
+// for cmd.exe which doesn't support them: as in NewShellCommand, they are
+// extracted. Those of pipelines and lists are left to the shell, as they
+// only apply to their first command.
+func NewShellScriptCommand(shell, cmd string) (*exec.Cmd, error) {
+	script := strings.TrimLeft(cmd, " \t")
+	env, rest, err := splitAssignments(script)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case isCmdExe(shell) && isSimpleCommand(rest):
+		c := exec.Command(shell, "/C", rest)
+		c.Env = env
+		return c, nil
+	case isCmdExe(shell):
+		return exec.Command(shell, "/C", script), nil
+	case isSimpleCommand(rest) && !isBuiltin(rest):
+		script = script[:len(script)-len(rest)] + "exec " + rest
+	}
+	return exec.Command(shell, "-c", script), nil
+}
+
+// splitAssignments splits the leading VAR=value words of cmd from
+// the remaining command.
+func splitAssignments(cmd string) ([]string, string, error) {
+	var env []string
+	rest := strings.TrimLeft(cmd, " \t")
+	for envvarRegexp.MatchString(rest) {
+		end := wordEnd(rest)
+		words, err := splitWords(rest[:end], nil)
+		if err != nil {
+			return nil, "", err
+		}
+		env = append(env, words[0].value)
+		rest = strings.TrimLeft(rest[end:], " \t")
+	}
+	return env, rest, nil
+}
+
+// wordEnd returns the index where the first shell word of s ends.
+func wordEnd(s string) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && quote != '\'':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case isBlank(c):
+			return i
+		}
+	}
+	return len(s)
+}
+
+// isSimpleCommand reports whether cmd is a single command, which may
+// use redirections and substitutions but no pipes, lists or subshells.
+func isSimpleCommand(cmd string) bool {
+	if strings.HasPrefix(cmd, "(") || strings.HasPrefix(cmd, "{") {
+		return false
+	}
+
+	var quote byte
+	for i := 0; i < len(cmd); i++ {
+		c := cmd[i]
+		switch {
+		case c == '\\' && quote != '\'':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '$' && i+1 < len(cmd) && cmd[i+1] == '(':
+			// a command substitution makes no list
+			i = substitutionEnd(cmd, i+1)
+		case strings.IndexByte("|&;\n", c) >= 0:
+			if c == '&' && i > 0 && (cmd[i-1] == '>' || cmd[i-1] == '<') {
+				continue // 2>&1
+			}
+			return false
+		}
+	}
+	return true
+}
+
+// ShellCommands returns the names of the commands run by a shell script:
+// the first word of each of its simple commands, once assignments,
+// redirections and reserved words are skipped. Builtins, names given by
+// parameters and commands run by substitutions are left out.
+func ShellCommands(script string) []string {
+	var names []string
+	start := 0
+	command := func(end int) {
+		if name := commandName(script[start:end]); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	var quote byte
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '\\' && quote != '\'':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '$' && i+1 < len(script) && script[i+1] == '(':
+			i = substitutionEnd(script, i+1)
+		case c == '$':
+			_, w := parameterRef(script[i+1:])
+			i += w
+		case c == '`':
+			if n := strings.IndexByte(script[i+1:], '`'); n >= 0 {
+				i += n + 1
+			} else {
+				i = len(script)
+			}
+		case c == '#' && (i == 0 || isBlank(script[i-1])):
+			command(i)
+			if n := strings.IndexByte(script[i:], '\n'); n >= 0 {
+				i += n
+			} else {
+				i = len(script)
+			}
+			start = i + 1
+		case strings.IndexByte("|&;\n()", c) >= 0:
+			if c == '&' && i > 0 && (script[i-1] == '>' || script[i-1] == '<') {
+				continue // 2>&1
+			}
+			command(i)
+			start = i + 1
+		}
+	}
+	if start < len(script) {
+		command(len(script))
+	}
+	return names
+}
+
+var (
+	// shellPrefixes are reserved words and builtins followed by a command
+	shellPrefixes = wordSet("if then else elif while until do ! { } time exec command fi done")
+
+	// shellCompounds are reserved words starting commands which run
+	// nothing by themselves
+	shellCompounds = wordSet("for case esac in select function")
+
+	shellBuiltins = wordSet(". : [ alias bg break cd continue echo eval exit export false " +
+		"fg getopts jobs kill local printf pwd read readonly return set shift source " +
+		"test times trap true type ulimit umask unalias unset wait")
+
+	redirectionRegexp = regexp.MustCompile("^[0-9]*(<|>|>>|<<|<>|>&|<&|>\\|)$")
+)
+
+func wordSet(words string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(words) {
+		set[w] = true
+	}
+	return set
+}
+
+// isBuiltin reports whether the simple command cmd starts with a shell
+// builtin or reserved word, which exec can't run.
+func isBuiltin(cmd string) bool {
+	words, err := splitWords(cmd, nil)
+	if err != nil || len(words) == 0 {
+		return false
+	}
+	w := words[0].value
+	return shellBuiltins[w] || shellPrefixes[w] || shellCompounds[w]
+}
+
+// commandName returns the name of the command run by a simple command.
+func commandName(cmd string) string {
+	words, err := splitWords(cmd, nil)
+	if err != nil {
+		return ""
+	}
+
+	for i := 0; i < len(words); i++ {
+		w := words[i].value
+		switch {
+		case words[i].assignment, shellPrefixes[w]:
+			continue
+		case redirectionRegexp.MatchString(w):
+			i++ // skip the target
+			continue
+		case w != "" && (w[0] == '<' || w[0] == '>'), '0' <= w[0] && w[0] <= '9' && strings.ContainsAny(w, "<>"):
+			continue
+		case shellCompounds[w], shellBuiltins[w], strings.ContainsAny(w, "$`"):
+			return ""
+		}
+		return w
+	}
+	return ""
+}
+
+// substitutionEnd returns the index of the parenthesis closing the one
+// at i, or len(cmd) if it is never closed.
+func substitutionEnd(cmd string, i int) int {
+	depth := 0
+	for ; i < len(cmd); i++ {
+		if cmd[i] == '(' {
+			depth++
+		} else if cmd[i] == ')' {
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(cmd)
+}
+
+// expandScript expands the parameters of a shell script as the shell
+// would, to report undefined and required variables before running it.
+// Single-quoted text, comments and command substitutions, whose variables
+// may be set by the script itself, are skipped.
+func expandScript(script string, expander *Expander) error {
+	var undefined []string
+	var quote byte
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == '\\' && quote != '\'':
+			i++
+		case quote == '\'':
+			if c == '\'' {
+				quote = 0
+			}
+		case c == '\'' && quote == 0:
+			quote = c
+		case c == '"':
+			quote ^= '"'
+		case c == '#' && quote == 0 && (i == 0 || isBlank(script[i-1])):
+			if n := strings.IndexByte(script[i:], '\n'); n >= 0 {
+				i += n
+			} else {
+				i = len(script)
+			}
+		case c == '`':
+			if n := strings.IndexByte(script[i+1:], '`'); n >= 0 {
+				i += n + 1
+			} else {
+				i = len(script)
+			}
+		case c == '$' && i+1 < len(script) && script[i+1] == '(':
+			i = substitutionEnd(script, i+1)
+		case c == '$':
+			ref, w := parameterRef(script[i+1:])
+			if w == 0 {
+				continue
+			}
+			if _, err := expander.parameter(ref, &undefined); err != nil {
+				return fmt.Errorf("procker: %s", err)
+			}
+			i += w
+		}
+	}
+
+	if expander.Strict && len(undefined) > 0 {
+		return &UndefinedError{undefined}
+	}
+	return nil
+}
+
+func isCmdExe(shell string) bool {
+	name := strings.ToLower(shell[strings.LastIndexAny(shell, `/\`)+1:])
+	return name == "cmd" || name == "cmd.exe"
+}
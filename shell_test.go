@@ -0,0 +1,161 @@
+package procker
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestNeedsShell(t *testing.T) {
+	for cmd, expected := range map[string]bool{
+		"bundle exec thin start -p $PORT":   false,
+		`echo 'a | b' "c && d" e\;f`:        false,
+		"echo http://example.com/~user":     false,
+		"cat access.log | grep GET":         true,
+		"make && ./app":                     true,
+		"./app > app.log 2>&1":              true,
+		"(cd web && npm start)":             true,
+		"echo $(date) `hostname`":           true,
+		"echo \"started at $(date)\"":       true,
+		"rm tmp/*.pid":                      true,
+		"~/bin/app":                         true,
+		"./worker; ./worker":                true,
+		"echo '$(not a substitution)' 'a*'": false,
+	} {
+		assert(t, expected, NeedsShell(cmd))
+	}
+}
+
+func TestShellScriptCommand(t *testing.T) {
+	cmd, err := NewShellScriptCommand("/bin/sh", "ANSWER=42 LOG='app log' ./app > $LOG")
+
+	var env []string
+	assert(t, nil, err)
+	assert(t, []string{"/bin/sh", "-c", "ANSWER=42 LOG='app log' exec ./app > $LOG"}, cmd.Args)
+	assert(t, env, cmd.Env)
+}
+
+func TestShellScriptCommandWithBuiltin(t *testing.T) {
+	for cmd, script := range map[string]string{
+		"exit 3":            "exit 3",
+		"CODE=3 exit $CODE": "CODE=3 exit $CODE",
+		"exec ./app":        "exec ./app",
+		"echo $PORT > port": "echo $PORT > port",
+		"ulimit -n 1024":    "ulimit -n 1024",
+		"./app > $LOG 2>&1": "exec ./app > $LOG 2>&1",
+	} {
+		c, err := NewShellScriptCommand("/bin/sh", cmd)
+		assert(t, nil, err)
+		assert(t, []string{"/bin/sh", "-c", script}, c.Args)
+	}
+}
+
+func TestShellScriptCommandExpandsAssignments(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	p := &SysProcess{
+		Command:   "GREETING=\"hello $NAME\" DIR=$HOME/x printenv GREETING DIR",
+		Env:       []string{"NAME=procker", "HOME=/home/procker"},
+		Stdout:    stdout,
+		ShellMode: ShellAlways,
+	}
+
+	assert(t, nil, p.Start())
+	assert(t, nil, p.Wait())
+	assert(t, "hello procker\n/home/procker/x\n", stdout.String())
+}
+
+func TestShellScriptCommandWithCmdExe(t *testing.T) {
+	cmd, err := NewShellScriptCommand("cmd.exe", "ANSWER=42 app.exe --port %PORT%")
+
+	assert(t, nil, err)
+	assert(t, []string{"cmd.exe", "/C", "app.exe --port %PORT%"}, cmd.Args)
+	assert(t, []string{"ANSWER=42"}, cmd.Env)
+}
+
+func TestShellScriptCommandWithList(t *testing.T) {
+	cmd, err := NewShellScriptCommand("/bin/bash", "make && ./app 2>&1 | tee app.log")
+
+	var env []string
+	assert(t, nil, err)
+	assert(t, []string{"/bin/bash", "-c", "make && ./app 2>&1 | tee app.log"}, cmd.Args)
+	assert(t, env, cmd.Env)
+}
+
+func TestShellScriptCommandKeepsAssignmentsOfLists(t *testing.T) {
+	cmd, err := NewShellScriptCommand("/bin/sh", "A=1 make && ./app | tr x y")
+
+	var env []string
+	assert(t, nil, err)
+	assert(t, []string{"/bin/sh", "-c", "A=1 make && ./app | tr x y"}, cmd.Args)
+	assert(t, env, cmd.Env)
+}
+
+func TestShellCommands(t *testing.T) {
+	for script, expected := range map[string][]string{
+		"bundle exec puma | tee log":                   {"bundle", "tee"},
+		"RAILS_ENV=test rake db:migrate && ./app 2>&1": {"rake", "./app"},
+		"cd web; exec >log node server.js":             {"node"},
+		"if test -f x; then make; fi":                  {"make"},
+		"{ sleep 1; worker; } # runs $(later)":         {"sleep", "worker"},
+		"for f in *; do gzip \"$f\"; done | sort":      {"gzip", "sort"},
+		"$CMD --flag | grep \"a|b\" > out":             {"grep"},
+		"echo $(hostname) `date` ${X:-a;b}":            nil,
+	} {
+		assert(t, expected, ShellCommands(script))
+	}
+}
+
+func TestProcessCheckSkipsQuotedShellText(t *testing.T) {
+	for _, cmd := range []string{
+		`awk '{print $NF}' | sort`,
+		`echo '${X:?x}' | cat`,
+		`echo "it's $HOME" | cat # $COMMENT`,
+		"echo $(echo $INNER) `echo $INNER` | cat",
+	} {
+		p := &SysProcess{Command: cmd, Env: []string{"HOME=/root"}, Strict: true}
+		if err := p.Check(); err != nil {
+			t.Errorf("%q: %v", cmd, err)
+		}
+	}
+
+	p := &SysProcess{Command: `echo '$A' "$B" $C | cat`, Strict: true}
+	err := p.Check()
+	if err == nil {
+		t.Fatalf("must report undefined variables")
+	}
+	assert(t, "procker: undefined variables: B, C", err.Error())
+}
+
+func TestProcessStartUsingShell(t *testing.T) {
+	stdOut := &bytes.Buffer{}
+	stdErr := &bytes.Buffer{}
+	env := []string{"PROCKER_MSG=hello"}
+
+	p := NewProcess("PROCKER_MSG2=world sh -c 'echo $PROCKER_MSG $PROCKER_MSG2' | tr a-z A-Z",
+		"", env, stdOut, stdErr)
+	err := p.Start()
+
+	if err != nil {
+		t.Fatal("process failed")
+	}
+
+	err = p.Wait()
+	if err != nil {
+		t.Fatal("process failed")
+	}
+
+	assert(t, "HELLO WORLD\n", stdOut.String())
+	assert(t, "", stdErr.String())
+}
+
+func TestProcessStartUsingShellMode(t *testing.T) {
+	stdOut := &bytes.Buffer{}
+
+	p := &SysProcess{Command: "echo -n $0", Stdout: stdOut, ShellMode: ShellAlways}
+	err := p.Start()
+	if err != nil {
+		t.Fatal("process failed")
+	}
+	p.Wait()
+
+	assert(t, DefaultShell, stdOut.String())
+}
@@ -4,12 +4,11 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"regexp"
 	"strings"
-
-	"github.com/flynn/go-shlex"
 )
 
 // PrefixedWriter implements prefixed output for an io.Writer object.
@@ -36,68 +35,113 @@ func (w *PrefixedWriter) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
-var procfileRegexp = regexp.MustCompile("^([A-Za-z0-9_]+):\\s*(.+)$")
+var procfileRegexp = regexp.MustCompile("^([A-Za-z0-9_][A-Za-z0-9_-]*):\\s*(.+)$")
+
+// ProcfileEntry is a process type declared in a Procfile.
+type ProcfileEntry struct {
+	Name    string
+	Command string
+	Line    int
+}
+
+// ParseError describes an error found at a given line of a parsed file.
+type ParseError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("procker: line %d: %s", e.Line, e.Msg)
+	}
+	return fmt.Sprintf("procker: %s:%d: %s", e.File, e.Line, e.Msg)
+}
 
 // ParseProcfile parses io.Reader into a process's map.
 // Read more about Procfiles: https://devcenter.heroku.com/articles/procfile
 func ParseProcfile(r io.Reader) (map[string]string, error) {
+	entries, err := ParseProcfileEntries(r, "")
+	if err != nil {
+		return nil, err
+	}
+
 	p := make(map[string]string)
+	for _, entry := range entries {
+		p[entry.Name] = entry.Command
+	}
+	return p, nil
+}
+
+// ParseProcfileEntries parses io.Reader into a list of entries, keeping
+// the order in which they were declared. Blank lines and lines starting
+// with '#' are ignored. The filename is only used to report errors.
+func ParseProcfileEntries(r io.Reader, filename string) ([]ProcfileEntry, error) {
+	var entries []ProcfileEntry
+	lines := make(map[string]int)
 	scanner := bufio.NewScanner(r)
+	n := 0
 	for scanner.Scan() {
+		n++
 		line := strings.TrimSpace(scanner.Text())
-		if len(line) == 0 {
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
 			continue
 		}
 
 		matches := procfileRegexp.FindStringSubmatch(line)
 		if matches == nil {
-			return nil, fmt.Errorf("procker: parse procfile error: invalid line found: '%s'", line)
+			return nil, &ParseError{filename, n, fmt.Sprintf("invalid line found: '%s'", line)}
 		}
 
 		name, command := matches[1], matches[2]
-		p[name] = command
+		if first, ok := lines[name]; ok {
+			return nil, &ParseError{filename, n,
+				fmt.Sprintf("duplicate process name '%s', first declared at line %d", name, first)}
+		}
+		lines[name] = n
+		entries = append(entries, ProcfileEntry{Name: name, Command: command, Line: n})
 	}
 
 	if err := scanner.Err(); err != nil {
 		return nil, fmt.Errorf("procker: parse procfile error: %s", err)
 	}
 
-	return p, nil
+	return entries, nil
 }
 
 // ParseEnv parses io.Reader into an arrays of strings
 // representing the environment, in the form "key=value".
 func ParseEnv(r io.Reader) ([]string, error) {
-	sysenv := env2Map(os.Environ())
-	localenv := make(map[string]string)
-	mapping := func(key string) string {
-		value, ok := localenv[key]
-		if !ok {
-			value, ok = sysenv[key]
-		}
-		return value
-	}
-
-	env := []string{}
-	scanner := bufio.NewScanner(r)
-	for scanner.Scan() {
-		entry := strings.TrimSpace(scanner.Text())
-		if len(entry) == 0 {
-			continue
-		}
+	return ParseEnvFile(r, "")
+}
 
-		pair := strings.SplitN(entry, "=", 2)
-		key := pair[0]
-		value := os.Expand(pair[1], mapping)
-		localenv[key] = value
-		env = append(env, fmt.Sprintf("%s=%s", key, value))
-	}
+// ParseEnvFile parses io.Reader in the dotenv format into an arrays of
+// strings representing the environment, in the form "key=value".
+// Values may be single-quoted (taken literally), double-quoted
+// (supporting escape sequences and spanning multiple lines) or unquoted.
+// Variables referenced in unquoted and double-quoted values are expanded
+// using previously parsed entries and the system environment.
+// The filename is only used to report errors.
+func ParseEnvFile(r io.Reader, filename string) ([]string, error) {
+	return ParseEnvOverlay(r, filename, os.Environ())
+}
 
-	if err := scanner.Err(); err != nil {
+// ParseEnvOverlay is like ParseEnvFile but parses io.Reader as an overlay
+// of the base environment: variables are expanded using previously parsed
+// entries, then base entries (later entries take precedence). Only the
+// entries found in io.Reader are returned.
+func ParseEnvOverlay(r io.Reader, filename string, base []string) ([]string, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
 		return nil, fmt.Errorf("procker: parse env error: %s", err)
 	}
 
-	return env, nil
+	p := &envParser{
+		src:      string(data),
+		filename: filename,
+		base:     env2Map(base),
+	}
+	return p.parse()
 }
 
 func env2Map(env []string) map[string]string {
@@ -119,21 +163,5 @@ var envvarRegexp = regexp.MustCompile("^[a-zA-Z_][a-zA-Z0-9_]*=")
 // It extracts environment variables specified at the start of
 // a command since Bourne-style shells allow it.
 func NewShellCommand(cmd string) (*exec.Cmd, error) {
-	args, err := shlex.Split(cmd)
-	if err != nil {
-		return nil, err
-	}
-
-	var env []string
-	for _, arg := range args {
-		if !envvarRegexp.MatchString(arg) {
-			break
-		}
-		env = append(env, arg)
-		args = args[1:]
-	}
-
-	c := exec.Command(args[0], args[1:]...)
-	c.Env = env
-	return c, nil
+	return NewCommand(cmd, nil)
 }
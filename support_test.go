@@ -53,7 +53,7 @@ redis:   redis-server /usr/local/etc/redis.conf
 }
 
 func TestMustNotParseProcfileWithInvalidTypeNames(t *testing.T) {
-	r := strings.NewReader(`web-9: bundle exec thin start
+	r := strings.NewReader(`web.9: bundle exec thin start
 job: bundle exec rake jobs:work`)
 
 	_, err := ParseProcfile(r)
@@ -62,6 +62,44 @@ job: bundle exec rake jobs:work`)
 	}
 }
 
+func TestParseProcfileEntries(t *testing.T) {
+	r := strings.NewReader(`# processes
+web-app: bundle exec thin start
+
+  # background jobs
+worker:  bundle exec rake jobs:work
+clock:   bundle exec clockwork`)
+
+	entries, err := ParseProcfileEntries(r, "Procfile")
+
+	assert(t, nil, err)
+	assert(t, []ProcfileEntry{
+		{Name: "web-app", Command: "bundle exec thin start", Line: 2},
+		{Name: "worker", Command: "bundle exec rake jobs:work", Line: 5},
+		{Name: "clock", Command: "bundle exec clockwork", Line: 6},
+	}, entries)
+}
+
+func TestParseProcfileEntriesReportsLine(t *testing.T) {
+	r := strings.NewReader(`web: bundle exec thin start
+
+worker bundle exec rake jobs:work`)
+
+	_, err := ParseProcfileEntries(r, "Procfile")
+
+	assert(t, "procker: Procfile:3: invalid line found: 'worker bundle exec rake jobs:work'", err.Error())
+}
+
+func TestParseProcfileEntriesRejectsDuplicates(t *testing.T) {
+	r := strings.NewReader(`web: bundle exec thin start
+worker: bundle exec rake jobs:work
+web: bundle exec puma`)
+
+	_, err := ParseProcfileEntries(r, "Procfile")
+
+	assert(t, "procker: Procfile:3: duplicate process name 'web', first declared at line 1", err.Error())
+}
+
 func TestParseEnv(t *testing.T) {
 	r := strings.NewReader(`RAILS_ENV=production
 QUEUE=system
@@ -1,6 +1,6 @@
 #!/bin/sh
 
-trap "echo bye" SIGTERM
+trap "echo bye" TERM
 
 sleep $1
 echo -n $2
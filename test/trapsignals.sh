@@ -0,0 +1,9 @@
+#!/bin/sh
+
+trap "echo hup" HUP
+trap "echo usr1" USR1
+
+echo ready
+while true; do
+	sleep 0.1
+done
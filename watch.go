@@ -0,0 +1,263 @@
+package procker
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// PollInterval is how often watchers scan their files when file system
+// notifications are not available.
+var PollInterval = time.Second
+
+// Watcher watches the files under a directory matching a set of glob
+// patterns, reporting changes on Events.
+//
+// Patterns and ignore rules use '/' separated paths relative to the
+// watched directory, where "**" matches any number of directories.
+// A pattern without '/' matches file names at any depth, so "*.go"
+// matches "main.go" and "cmd/app/main.go". Ignored directories are
+// not watched at all.
+//
+// Changes are reported once no file changed for the debounce delay,
+// as the sorted list of changed files.
+type Watcher struct {
+	Events <-chan []string
+
+	dir      string
+	patterns []string
+	ignore   []string
+	debounce time.Duration
+	done     chan struct{}
+	once     sync.Once
+}
+
+// NewWatcher starts watching the files under dir matching patterns.
+// File system notifications are used where supported, falling back
+// to scanning the files every PollInterval.
+func NewWatcher(dir string, patterns, ignore []string, debounce time.Duration) (*Watcher, error) {
+	return newWatcher(dir, patterns, ignore, debounce, watchNotify)
+}
+
+// watchFunc sends the changed paths under the watched directory until
+// done is closed. It fails if it can't watch the directory at all.
+type watchFunc func(w *Watcher, changes chan<- string) error
+
+func newWatcher(dir string, patterns, ignore []string, debounce time.Duration, watch watchFunc) (*Watcher, error) {
+	if len(patterns) == 0 {
+		return nil, errors.New("procker: no pattern to watch")
+	}
+	for _, pattern := range append(append([]string{}, patterns...), ignore...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("procker: invalid pattern '%s'", pattern)
+		}
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("procker: %s: not a directory", dir)
+	}
+
+	events := make(chan []string)
+	w := &Watcher{
+		Events:   events,
+		dir:      dir,
+		patterns: patterns,
+		ignore:   ignore,
+		debounce: debounce,
+		done:     make(chan struct{}),
+	}
+
+	changes := make(chan string)
+	if err := watch(w, changes); err != nil {
+		if err := watchPoll(w, changes); err != nil {
+			return nil, err
+		}
+	}
+	go w.collect(changes, events)
+	return w, nil
+}
+
+// Close stops watching files.
+func (w *Watcher) Close() error {
+	w.once.Do(func() { close(w.done) })
+	return nil
+}
+
+// collect debounces the changes matching the patterns into events.
+func (w *Watcher) collect(changes <-chan string, events chan<- []string) {
+	defer close(events)
+
+	changed := make(map[string]bool)
+	var timer <-chan time.Time
+	for {
+		select {
+		case name := <-changes:
+			if w.matches(name) {
+				changed[name] = true
+				timer = time.After(w.debounce)
+			}
+		case <-timer:
+			files := make([]string, 0, len(changed))
+			for name := range changed {
+				files = append(files, name)
+			}
+			sort.Strings(files)
+			changed = make(map[string]bool)
+			timer = nil
+
+			select {
+			case events <- files:
+			case <-w.done:
+				return
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// matches reports whether the file named by the relative path name
+// is watched.
+func (w *Watcher) matches(name string) bool {
+	if w.ignored(name) {
+		return false
+	}
+	for _, pattern := range w.patterns {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ignored reports whether the relative path name, or any
+// of its parent directories, is ignored.
+func (w *Watcher) ignored(name string) bool {
+	for p := name; p != "." && p != "/"; p = path.Dir(p) {
+		for _, pattern := range w.ignore {
+			if matchGlob(pattern, p) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// rel returns the '/' separated path of file relative to the watched
+// directory.
+func (w *Watcher) rel(file string) string {
+	name, err := filepath.Rel(w.dir, file)
+	if err != nil {
+		return filepath.ToSlash(file)
+	}
+	return filepath.ToSlash(name)
+}
+
+// walk calls f on the files and directories under the watched
+// directory which are not ignored.
+func (w *Watcher) walk(root string, f func(file string, info os.FileInfo)) {
+	filepath.Walk(root, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if file != w.dir && w.ignored(w.rel(file)) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		f(file, info)
+		return nil
+	})
+}
+
+// watchPoll scans the watched files every PollInterval, reporting
+// the files created, modified or removed since the last scan.
+func watchPoll(w *Watcher, changes chan<- string) error {
+	type stamp struct {
+		modTime time.Time
+		size    int64
+	}
+
+	scan := func() map[string]stamp {
+		files := make(map[string]stamp)
+		w.walk(w.dir, func(file string, info os.FileInfo) {
+			if !info.IsDir() {
+				files[w.rel(file)] = stamp{info.ModTime(), info.Size()}
+			}
+		})
+		return files
+	}
+
+	go func() {
+		files := scan()
+		ticker := time.NewTicker(PollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-w.done:
+				return
+			}
+
+			current := scan()
+			var changed []string
+			for name, s := range current {
+				if previous, ok := files[name]; !ok || previous != s {
+					changed = append(changed, name)
+				}
+			}
+			for name := range files {
+				if _, ok := current[name]; !ok {
+					changed = append(changed, name)
+				}
+			}
+			files = current
+
+			for _, name := range changed {
+				select {
+				case changes <- name:
+				case <-w.done:
+					return
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// matchGlob reports whether the '/' separated path name matches pattern.
+// "**" matches any number of directories, and patterns without '/'
+// match the last element of name.
+func matchGlob(pattern, name string) bool {
+	if !strings.Contains(pattern, "/") {
+		return matchSegments([]string{pattern}, []string{path.Base(name)})
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
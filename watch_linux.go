@@ -0,0 +1,106 @@
+// +build linux
+
+package procker
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY |
+	syscall.IN_DELETE | syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ATTRIB
+
+// watchNotify watches the directories under the watched directory
+// using inotify, watching new directories as they are created.
+func watchNotify(w *Watcher, changes chan<- string) error {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return err
+	}
+	// a non-blocking file is handled by the runtime poller,
+	// so closing it interrupts pending reads
+	file := os.NewFile(uintptr(fd), "inotify")
+
+	// add watches the directories under root, returning the files
+	// found there
+	dirs := make(map[int32]string)
+	add := func(root string) ([]string, error) {
+		var files []string
+		var err error
+		w.walk(root, func(file string, info os.FileInfo) {
+			if !info.IsDir() {
+				files = append(files, file)
+				return
+			}
+			if err != nil {
+				return
+			}
+			wd, e := syscall.InotifyAddWatch(fd, file, inotifyMask)
+			if e != nil {
+				err = e
+				return
+			}
+			dirs[int32(wd)] = file
+		})
+		return files, err
+	}
+	if _, err := add(w.dir); err != nil {
+		file.Close()
+		return err
+	}
+
+	go func() {
+		<-w.done
+		file.Close()
+	}()
+
+	go func() {
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		for {
+			n, err := file.Read(buf)
+			if err != nil {
+				return
+			}
+
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				nameStart := offset + syscall.SizeofInotifyEvent
+				name := string(buf[nameStart : nameStart+int(event.Len)])
+				offset = nameStart + int(event.Len)
+
+				dir, ok := dirs[event.Wd]
+				if !ok || event.Len == 0 {
+					continue
+				}
+				files := []string{filepath.Join(dir, trimNull(name))}
+				if event.Mask&syscall.IN_ISDIR != 0 {
+					if event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) == 0 {
+						continue
+					}
+					// files may be created before the new directory is watched
+					files, _ = add(files[0])
+				}
+
+				for _, file := range files {
+					select {
+					case changes <- w.rel(file):
+					case <-w.done:
+						return
+					}
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+func trimNull(s string) string {
+	for i := 0; i < len(s); i++ {
+		if s[i] == 0 {
+			return s[:i]
+		}
+	}
+	return s
+}
@@ -0,0 +1,10 @@
+// +build !linux
+
+package procker
+
+import "errors"
+
+// watchNotify is only supported on Linux, where inotify is used.
+func watchNotify(w *Watcher, changes chan<- string) error {
+	return errors.New("procker: file system notifications not supported")
+}
@@ -0,0 +1,106 @@
+package procker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/app/main.go", true},
+		{"*.go", "main.rb", false},
+		{"app/*.rb", "app/user.rb", true},
+		{"app/*.rb", "app/models/user.rb", false},
+		{"app/**/*.rb", "app/user.rb", true},
+		{"app/**/*.rb", "app/models/user.rb", true},
+		{"app/**", "app/models/user.rb", true},
+		{"**/*_test.go", "watch_test.go", true},
+		{"config/routes.rb", "config/routes.rb", true},
+		{"config/routes.rb", "app/config/routes.rb", false},
+	}
+
+	for _, test := range tests {
+		if matchGlob(test.pattern, test.name) != test.match {
+			t.Errorf("matchGlob(%q, %q) should be %v", test.pattern, test.name, test.match)
+		}
+	}
+}
+
+func TestWatcherMatches(t *testing.T) {
+	w := &Watcher{
+		patterns: []string{"*.go", "templates/**"},
+		ignore:   []string{"vendor", "*_test.go"},
+	}
+
+	assert(t, true, w.matches("main.go"))
+	assert(t, true, w.matches("templates/index.html"))
+	assert(t, false, w.matches("README.md"))
+	assert(t, false, w.matches("vendor/lib/lib.go"))
+	assert(t, false, w.matches("main_test.go"))
+}
+
+func TestNewWatcherErrors(t *testing.T) {
+	_, err := NewWatcher(".", nil, nil, 0)
+	assert(t, "procker: no pattern to watch", err.Error())
+
+	_, err = NewWatcher(".", []string{"[a"}, nil, 0)
+	assert(t, "procker: invalid pattern '[a'", err.Error())
+
+	_, err = NewWatcher("/nonexistent", []string{"*.go"}, nil, 0)
+	assert(t, "procker: /nonexistent: not a directory", err.Error())
+}
+
+func TestWatcherNotify(t *testing.T) {
+	testWatcher(t, watchNotify)
+}
+
+func TestWatcherPoll(t *testing.T) {
+	interval := PollInterval
+	PollInterval = 50 * time.Millisecond
+	defer func() { PollInterval = interval }()
+
+	testWatcher(t, watchPoll)
+}
+
+func testWatcher(t *testing.T, watch watchFunc) {
+	dir, _ := ioutil.TempDir("", "procker")
+	defer os.RemoveAll(dir)
+	write := func(name string) {
+		file := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(file), 0755)
+		if err := ioutil.WriteFile(file, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("main.go")
+	write("vendor/lib.go")
+
+	w, err := newWatcher(dir, []string{"*.go"}, []string{"vendor"}, 200*time.Millisecond, watch)
+	if err != nil {
+		t.Skipf("watcher not supported: %v", err)
+	}
+	defer w.Close()
+
+	// give the poller time to take its first snapshot
+	time.Sleep(100 * time.Millisecond)
+	write("main.go")
+	write("app/app.go")
+	write("vendor/lib.go")
+	write("README.md")
+
+	select {
+	case files := <-w.Events:
+		assert(t, true, reflect.DeepEqual([]string{"app/app.go", "main.go"}, files))
+	case <-time.After(2 * time.Second):
+		t.Fatal("no change reported")
+	}
+}